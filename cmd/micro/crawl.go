@@ -0,0 +1,180 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bukowa/micro/selector"
+	"github.com/bukowa/micro/spec"
+)
+
+// Scopes of the crawl.
+const (
+	// ScopeHost follows links to the host of the seed.
+	ScopeHost = "host"
+	// ScopeDomain follows links to the domain of the seed and its subdomains.
+	ScopeDomain = "domain"
+	// ScopeAll follows all links.
+	ScopeAll = "all"
+)
+
+func crawl(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var s = &spec.Spec{
+		Name: "crawl",
+		Extract: []spec.ExtractSpec{
+			{Name: "links", Selector: "a", Attributes: []string{"href"}, Follow: true},
+		},
+	}
+	var seeds, scope string
+	var idle = time.Second * 2
+	fs := flag.NewFlagSet("crawl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: micro crawl [flags] [url...]")
+		fmt.Fprintln(stderr, "seed urls are read from arguments, -seeds file or stdin")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&seeds, "seeds", "", "file with seed urls, one per line, - reads stdin")
+	fs.IntVar(&s.Crawler.Size, "concurrency", 4, "number of concurrent requests")
+	fs.StringVar(&scope, "scope", ScopeHost, "links to follow: host, domain or all")
+	fs.IntVar(&s.Crawler.Depth, "depth", 1, "maximum depth of followed links, 0 crawls only seeds")
+	fs.Var(durationFlag{&s.Crawler.Delay}, "delay", "delay between requests to the same host")
+	fs.IntVar(&s.Crawler.MaxRequests, "max", 0, "maximum number of requests, 0 is unlimited")
+	fs.DurationVar(&idle, "idle", idle, "stop after crawler was idle for this long")
+	fs.StringVar(&s.Storage.Type, "format", spec.StorageText, "output format: text, jsonl or bolt")
+	fs.StringVar(&s.Storage.Path, "o", "", "output file, required for bolt, defaults to stdout")
+	fs.StringVar(&s.Report.JSON, "report-json", "", "file of json report written when the crawl is finished")
+	fs.StringVar(&s.Report.HTML, "report-html", "", "file of html report written when the crawl is finished")
+	fs.StringVar(&s.Crawler.UserAgent, "user-agent", "", "User-Agent header of requests")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	s.Crawler.Idle = spec.Duration(idle)
+	s.Crawler.Sleep = spec.Duration(time.Millisecond * 10)
+
+	var err error
+	if s.Seeds, err = readSeeds(fs.Args(), seeds, stdin); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if s.Scope.Allow, err = scopeSelectors(scope, s.Seeds); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if err := s.Validate(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	return runSpec(s, stdout, stderr)
+}
+
+// readSeeds returns seed urls from args and file, stdin is read
+// when file is - or there are no other seeds.
+func readSeeds(args []string, file string, stdin io.Reader) ([]string, error) {
+	seeds := append([]string{}, args...)
+	var r io.Reader
+	switch {
+	case file == "-" || (file == "" && len(args) == 0):
+		r = stdin
+	case file != "":
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	if r == nil {
+		return seeds, nil
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		seeds = append(seeds, line)
+	}
+	return seeds, scanner.Err()
+}
+
+// scopeSelectors returns selectors allowing links in scope of the seeds.
+func scopeSelectors(scope string, seeds []string) ([]spec.SelectorSpec, error) {
+	var prefix string
+	switch scope {
+	case ScopeAll:
+		return nil, nil
+	case ScopeHost:
+		prefix = `^https?://`
+	case ScopeDomain:
+		prefix = `^https?://([^/?#]*\.)?`
+	default:
+		return nil, fmt.Errorf("invalid scope %q", scope)
+	}
+	var sel = spec.SelectorSpec{Selector: selector.XRegexpMatch}
+	for _, seed := range seeds {
+		u, err := url.Parse(seed)
+		if err != nil {
+			continue
+		}
+		if u.Scheme == "file" {
+			// local files are in scope of the seed directory
+			dir := u.Path
+			if !strings.HasSuffix(dir, "/") {
+				dir = path.Dir(dir) + "/"
+			}
+			sel.Match = append(sel.Match, `^file://(localhost)?`+regexp.QuoteMeta(strings.TrimSuffix(dir, "/"))+`/`)
+			continue
+		}
+		host := u.Hostname()
+		if scope == ScopeDomain {
+			host = strings.TrimPrefix(host, "www.")
+		}
+		sel.Match = append(sel.Match, prefix+regexp.QuoteMeta(host)+`(:\d+)?([/?#]|$)`)
+	}
+	return []spec.SelectorSpec{sel}, nil
+}
+
+// durationFlag sets spec.Duration from command line.
+type durationFlag struct {
+	d *spec.Duration
+}
+
+func (f durationFlag) String() string {
+	if f.d == nil {
+		return "0s"
+	}
+	return time.Duration(*f.d).String()
+}
+
+func (f durationFlag) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*f.d = spec.Duration(d)
+	return nil
+}
@@ -0,0 +1,189 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bukowa/micro/spec"
+)
+
+func testServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/a">a</a><a href="/b#x">b</a><a href="http://example.invalid/">out</a>`)
+	})
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/c?utm_source=x">c</a><a href="/">home</a>`)
+	})
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/c", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/d">d</a>`)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestCrawl(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"-depth", "0"}, []string{"/"}},
+		{[]string{"-depth", "1"}, []string{"/", "/a", "/b"}},
+		{[]string{"-depth", "2"}, []string{"/", "/a", "/b", "/c?utm_source=x"}},
+		{[]string{"-depth", "2", "-max", "1"}, []string{"/"}},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		args := append([]string{"crawl", "-format", "jsonl", "-idle", "200ms"}, tt.args...)
+		code := run(args, strings.NewReader(server.URL+"/\n"), &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("%v: exit code %d: %s", tt.args, code, stderr.String())
+		}
+
+		var got []string
+		dec := json.NewDecoder(&stdout)
+		for dec.More() {
+			var p spec.Record
+			if err := dec.Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, strings.TrimPrefix(p.URL, server.URL))
+		}
+		sort.Strings(got)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%v: want %v, got %v", tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestCrawlUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run(nil, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("want exit code 2, got %d", code)
+	}
+	if code := run([]string{"crawl", "-scope", "invalid", "http://localhost"}, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("want exit code 2, got %d", code)
+	}
+	if code := run([]string{"crawl", "-format", "bolt", "http://localhost"}, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("want exit code 2, got %d", code)
+	}
+}
+
+func TestReadSeeds(t *testing.T) {
+	seeds, err := readSeeds(nil, "", strings.NewReader("http://a\n\n# comment\n http://b \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(seeds) != "[http://a http://b]" {
+		t.Errorf("invalid seeds: %v", seeds)
+	}
+	seeds, _ = readSeeds([]string{"http://c"}, "", strings.NewReader("http://a"))
+	if fmt.Sprint(seeds) != "[http://c]" {
+		t.Errorf("stdin should not be read: %v", seeds)
+	}
+}
+
+func TestScopeSelectors(t *testing.T) {
+	tests := []struct {
+		scope string
+		link  string
+		want  bool
+	}{
+		{ScopeHost, "http://www.example.com:8080/a", true},
+		{ScopeHost, "https://www.example.com", true},
+		{ScopeHost, "http://sub.example.com/", false},
+		{ScopeHost, "http://www.example.com.evil/", false},
+		{ScopeDomain, "http://sub.example.com/a", true},
+		{ScopeDomain, "http://example.com?x", true},
+		{ScopeDomain, "http://notexample.com/", false},
+	}
+	for _, tt := range tests {
+		sels, err := scopeSelectors(tt.scope, []string{"http://www.example.com/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sel, err := sels[0].New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(sel.Score(tt.link)) > 0; got != tt.want {
+			t.Errorf("%s %s: want %v", tt.scope, tt.link, tt.want)
+		}
+	}
+}
+
+func TestRunSpec(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	s := fmt.Sprintf(`{"seeds": [%q], "crawler": {"idle": "200ms"}}`, server.URL+"/")
+	if code := run([]string{"run", "-"}, strings.NewReader(s), &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "200 "+server.URL+"/ depth:0") {
+		t.Errorf("invalid output: %s", stdout.String())
+	}
+	if code := run([]string{"run", "-"}, strings.NewReader(`{}`), &stdout, &stderr); code != 2 {
+		t.Errorf("want exit code 2, got %d", code)
+	}
+}
+
+func TestCrawlFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "micro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "site", "docs"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "site", "page.html"), []byte(`<a href="docs/">docs</a><a href="../secret.txt">x</a>`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "site", "docs", "a.txt"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644)
+
+	var stdout, stderr bytes.Buffer
+	seed := "file://" + filepath.ToSlash(filepath.Join(dir, "site")) + "/"
+	code := run([]string{"crawl", "-depth", "3", "-idle", "200ms", seed}, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		got = append(got, strings.TrimPrefix(strings.Fields(line)[1], seed))
+	}
+	sort.Strings(got)
+	if fmt.Sprint(got) != "[ docs/ docs/a.txt page.html]" {
+		t.Errorf("invalid files crawled: %v", got)
+	}
+}
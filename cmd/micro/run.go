@@ -0,0 +1,60 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bukowa/micro/crawler"
+	"github.com/bukowa/micro/spec"
+)
+
+// runFile runs crawl described by spec files.
+func runFile(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "usage: micro run <spec.json|spec.yaml>")
+		fmt.Fprintln(stderr, "spec is read from stdin when file is -")
+		return 2
+	}
+	var s *spec.Spec
+	var err error
+	if args[0] == "-" {
+		s, err = spec.Parse(stdin)
+	} else {
+		s, err = spec.Load(args[0])
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	return runSpec(s, stdout, stderr)
+}
+
+// runSpec runs Pipeline of the Spec.
+func runSpec(s *spec.Spec, stdout, stderr io.Writer) int {
+	// dedupe links differing only in tracking parameters, fragments etc.
+	p, err := spec.New(s, stdout, crawler.WithLoggerOutput(stderr), crawler.WithRequestKey(crawler.CanonicalKey))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := p.Run(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
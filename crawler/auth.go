@@ -0,0 +1,404 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Auth authenticates requests.
+// It is applied after OnRequest functions, right before Request is sent,
+// so signatures cover all modifications of the Request.
+// It authenticates a copy of the http.Request, which is not stored with the Request.
+// It has to be safe to use by multiple goroutines.
+type Auth interface {
+	Authenticate(req *http.Request) error
+}
+
+// Refresher is implemented by Auth that can refresh its credentials.
+// Refresh is called when server responded with 401 Unauthorized,
+// if it returns true Request is authenticated and sent again once.
+type Refresher interface {
+	Refresh(res *http.Response) bool
+}
+
+// WithAuth authenticates requests sent to hosts with Auth.
+// Without hosts Auth is used for hosts that have no other Auth.
+var WithAuth = func(auth Auth, hosts ...string) Option {
+	return func(c *Crawler) {
+		if c.auth == nil {
+			c.auth = map[string]Auth{}
+		}
+		if len(hosts) == 0 {
+			c.auth[""] = auth
+		}
+		for _, host := range hosts {
+			c.auth[host] = auth
+		}
+	}
+}
+
+// authFor returns Auth of the host.
+func (c *Crawler) authFor(host string) Auth {
+	if a, ok := c.auth[host]; ok {
+		return a
+	}
+	return c.auth[""]
+}
+
+// do sends authenticated Request, once again if server responded with 401 and Auth was refreshed.
+// Copy of the http.Request is authenticated, so credentials are not stored
+// with the Request in checkpoints, recordings or queues.
+func (c *Crawler) do(t *trace, request Request) (*http.Response, error) {
+	req := request.Request()
+	auth := c.authFor(req.URL.Hostname())
+	if auth == nil {
+		return c.client.Do(t.request(req))
+	}
+	req = req.Clone(req.Context())
+	if err := auth.Authenticate(req); err != nil {
+		return nil, err
+	}
+	res, err := c.client.Do(t.request(req))
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+	r, ok := auth.(Refresher)
+	if !ok || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) || !r.Refresh(res) {
+		return res, err
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	req = req.Clone(req.Context())
+	if req.GetBody != nil {
+		if req.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	if err := auth.Authenticate(req); err != nil {
+		return nil, err
+	}
+	return c.client.Do(t.request(req))
+}
+
+// BasicAuth authenticates requests with HTTP Basic authentication.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// BearerAuth authenticates requests with static bearer token.
+type BearerAuth string
+
+func (a BearerAuth) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(a))
+	return nil
+}
+
+// ErrorToken is returned when token endpoint responded with unexpected status code.
+type ErrorToken int
+
+func (e ErrorToken) Error() string {
+	return fmt.Sprintf("token request failed with status %d", int(e))
+}
+
+// ClientCredentials authenticates requests with bearer token obtained
+// with OAuth2 client credentials grant. Token is requested when it's
+// missing or expired and refreshed when server responded with 401.
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Client sends token requests, defaults to http.DefaultClient.
+	Client *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+	call   *tokenCall
+}
+
+// tokenCall is a token request shared by concurrent callers of Token.
+type tokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// NewClientCredentials creates new ClientCredentials.
+func NewClientCredentials(tokenURL, clientID, clientSecret string, scopes ...string) *ClientCredentials {
+	return &ClientCredentials{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+	}
+}
+
+func (a *ClientCredentials) Authenticate(req *http.Request) error {
+	token, err := a.Token()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Refresh drops current token, so new one is requested.
+func (a *ClientCredentials) Refresh(res *http.Response) bool {
+	defer a.mu.Unlock()
+	a.mu.Lock()
+	// token could be already refreshed by another goroutine
+	if res.Request != nil && res.Request.Header.Get("Authorization") == "Bearer "+a.token {
+		a.token = ""
+	}
+	return true
+}
+
+// Token returns valid token, requesting new one if needed.
+// Tokens are treated as expired 10 seconds before their expiry.
+// Concurrent callers wait for the same token request.
+func (a *ClientCredentials) Token() (string, error) {
+	a.mu.Lock()
+	if a.token != "" && (a.expiry.IsZero() || time.Now().Before(a.expiry)) {
+		token := a.token
+		a.mu.Unlock()
+		return token, nil
+	}
+	if call := a.call; call != nil {
+		a.mu.Unlock()
+		<-call.done
+		return call.token, call.err
+	}
+	call := &tokenCall{done: make(chan struct{})}
+	a.call = call
+	a.mu.Unlock()
+
+	token, expiry, err := a.request()
+	a.mu.Lock()
+	if err == nil {
+		a.token, a.expiry = token, expiry
+	}
+	a.call = nil
+	a.mu.Unlock()
+	call.token, call.err = token, err
+	close(call.done)
+	return token, err
+}
+
+// request requests new token from TokenURL.
+func (a *ClientCredentials) request() (string, time.Time, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.Scopes, " "))
+	}
+	req, err := http.NewRequest(http.MethodPost, a.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", time.Time{}, ErrorToken(res.StatusCode)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", time.Time{}, err
+	}
+	if token.AccessToken == "" {
+		return "", time.Time{}, errors.New("token response has no access_token")
+	}
+	var expiry time.Time
+	if token.ExpiresIn > 0 {
+		expiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Second*10)
+	}
+	return token.AccessToken, expiry, nil
+}
+
+// HMACAuth signs requests with HMAC-SHA256, similarly to AWS Signature Version 4.
+// Canonical request consists of method, path, sorted query, signed headers
+// and SHA-256 of the body. Signed string consists of algorithm, date and
+// SHA-256 of canonical request. Requests have headers:
+//
+//	X-Date: 20060102T150405Z
+//	X-Content-Sha256: <hex body hash>
+//	Authorization: HMAC-SHA256 Credential=<key id>, SignedHeaders=host;x-date, Signature=<hex signature>
+type HMACAuth struct {
+	KeyID  string
+	Secret []byte
+	// Headers are signed in addition to Host, X-Date and X-Content-Sha256.
+	Headers []string
+	// Now returns signing time, defaults to time.Now.
+	Now func() time.Time
+}
+
+const hmacAlgorithm = "HMAC-SHA256"
+const hmacDate = "20060102T150405Z"
+
+// NewHMACAuth creates new HMACAuth.
+func NewHMACAuth(keyID string, secret []byte, headers ...string) *HMACAuth {
+	return &HMACAuth{KeyID: keyID, Secret: secret, Headers: headers}
+}
+
+func (a *HMACAuth) Authenticate(req *http.Request) error {
+	now := time.Now
+	if a.Now != nil {
+		now = a.Now
+	}
+	hash, err := bodyHash(req)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Date", now().UTC().Format(hmacDate))
+	req.Header.Set("X-Content-Sha256", hash)
+
+	signed := []string{"host", "x-content-sha256", "x-date"}
+	for _, h := range a.Headers {
+		signed = append(signed, strings.ToLower(h))
+	}
+	sort.Strings(signed)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s, SignedHeaders=%s, Signature=%s",
+		hmacAlgorithm, a.KeyID, strings.Join(signed, ";"), a.signature(req, signed, hash)))
+	return nil
+}
+
+// Verify checks signature of the request signed by HMACAuth with the same secret.
+func (a *HMACAuth) Verify(req *http.Request) error {
+	params := map[string]string{}
+	auth := strings.TrimPrefix(req.Header.Get("Authorization"), hmacAlgorithm+" ")
+	for _, p := range strings.Split(auth, ", ") {
+		if kv := strings.SplitN(p, "=", 2); len(kv) == 2 {
+			params[kv[0]] = kv[1]
+		}
+	}
+	if params["Credential"] != a.KeyID || params["SignedHeaders"] == "" {
+		return errors.New("invalid credential")
+	}
+	hash, err := bodyHash(req)
+	if err != nil {
+		return err
+	}
+	if hash != req.Header.Get("X-Content-Sha256") {
+		return errors.New("invalid body hash")
+	}
+	want := a.signature(req, strings.Split(params["SignedHeaders"], ";"), hash)
+	if !hmac.Equal([]byte(want), []byte(params["Signature"])) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func (a *HMACAuth) signature(req *http.Request, signed []string, hash string) string {
+	var canonical strings.Builder
+	canonical.WriteString(req.Method + "\n")
+	canonical.WriteString(req.URL.EscapedPath() + "\n")
+	canonical.WriteString(canonicalQuery(req.URL.Query()) + "\n")
+	for _, h := range signed {
+		v := strings.TrimSpace(req.Header.Get(h))
+		if h == "host" {
+			v = req.Host
+			if v == "" {
+				v = req.URL.Host
+			}
+		}
+		canonical.WriteString(h + ":" + v + "\n")
+	}
+	canonical.WriteString(strings.Join(signed, ";") + "\n")
+	canonical.WriteString(hash)
+
+	sum := sha256.Sum256([]byte(canonical.String()))
+	toSign := hmacAlgorithm + "\n" + req.Header.Get("X-Date") + "\n" + hex.EncodeToString(sum[:])
+	mac := hmac.New(sha256.New, a.Secret)
+	mac.Write([]byte(toSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalQuery encodes query sorted by keys and values.
+func canonicalQuery(q url.Values) string {
+	var params []string
+	for k, vv := range q {
+		for _, v := range vv {
+			params = append(params, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// bodyHash returns hex SHA-256 of the request body.
+// Body that cannot be read again is buffered.
+func bodyHash(req *http.Request) (string, error) {
+	var body []byte
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+	case req.GetBody != nil:
+		r, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		body, err = ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return "", err
+		}
+	default:
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
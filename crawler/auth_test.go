@@ -0,0 +1,258 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestAuthPerHost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+	local := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	var header = func(opts []Option, url string) string {
+		res := crawlBody(t, url, opts...)
+		return res
+	}
+	basic := []Option{WithAuth(BasicAuth{Username: "user", Password: "pass"}, "127.0.0.1")}
+	if h := header(basic, server.URL); h != "Basic dXNlcjpwYXNz" {
+		t.Errorf("invalid basic auth: %s", h)
+	}
+	if h := header(basic, local); h != "" {
+		t.Errorf("auth sent to other host: %s", h)
+	}
+	fallback := append(basic, WithAuth(BearerAuth("token")))
+	if h := header(fallback, local); h != "Bearer token" {
+		t.Errorf("invalid bearer auth: %s", h)
+	}
+
+	// auth is applied after OnRequest functions
+	overwrite := []Option{WithAuth(BearerAuth("token")), func(c *Crawler) {
+		c.OnRequest(func(i int, c *Crawler, r Request) error {
+			r.Request().Header.Set("Authorization", "overwritten")
+			return nil
+		})
+	}}
+	if h := header(overwrite, server.URL); h != "Bearer token" {
+		t.Errorf("auth applied before OnRequest: %s", h)
+	}
+
+	// credentials are not stored with the Request
+	res := crawlOne(t, server.URL, basic...)
+	if h := res.Request().Header.Get("Authorization"); res.Error() != nil || h != "" {
+		t.Errorf("credentials stored with the request: %s %v", h, res.Error())
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	var mu sync.Mutex
+	var issued int
+	var revoked = map[string]bool{}
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		r.ParseForm()
+		if id != "client" || secret != "secret" || r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "read write" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		issued++
+		token := fmt.Sprintf("token-%d", issued)
+		mu.Unlock()
+		fmt.Fprintf(w, `{"access_token": %q, "token_type": "bearer", "expires_in": 3600}`, token)
+	}))
+	defer tokens.Close()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Lock()
+		defer mu.Unlock()
+		if !strings.HasPrefix(token, "token-") || revoked[token] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, token)
+	}))
+	defer api.Close()
+
+	auth := NewClientCredentials(tokens.URL, "client", "secret", "read", "write")
+	if body := crawlBody(t, api.URL, WithAuth(auth)); body != "token-1" {
+		t.Errorf("want token-1, got %s", body)
+	}
+	// token is reused
+	if body := crawlBody(t, api.URL, WithAuth(auth)); body != "token-1" {
+		t.Errorf("want token-1, got %s", body)
+	}
+	// revoked token is refreshed on 401
+	mu.Lock()
+	revoked["token-1"] = true
+	mu.Unlock()
+	if body := crawlBody(t, api.URL, WithAuth(auth)); body != "token-2" {
+		t.Errorf("want token-2, got %s", body)
+	}
+
+	invalid := NewClientCredentials(tokens.URL, "client", "invalid")
+	res := crawlOne(t, api.URL, WithAuth(invalid))
+	if err, ok := res.Error().(ErrorToken); !ok || int(err) != http.StatusUnauthorized {
+		t.Errorf("want ErrorToken, got %v", res.Error())
+	}
+}
+
+func TestClientCredentialsExpiry(t *testing.T) {
+	var issued int
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issued++
+		// expires within 10s margin, so every token is treated as expired
+		fmt.Fprintf(w, `{"access_token": "token-%d", "expires_in": 5}`, issued)
+	}))
+	defer tokens.Close()
+
+	auth := NewClientCredentials(tokens.URL, "client", "secret")
+	first, _ := auth.Token()
+	second, _ := auth.Token()
+	if first != "token-1" || second != "token-2" {
+		t.Errorf("expired token reused: %s %s", first, second)
+	}
+}
+
+func TestClientCredentialsConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	var issued int
+	var release = make(chan struct{})
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		mu.Lock()
+		issued++
+		mu.Unlock()
+		fmt.Fprint(w, `{"access_token": "token", "expires_in": 3600}`)
+	}))
+	defer tokens.Close()
+
+	auth := NewClientCredentials(tokens.URL, "client", "secret")
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := auth.Token(); err != nil || token != "token" {
+				t.Errorf("invalid token: %s %v", token, err)
+			}
+		}()
+	}
+	// lock is not held while token is requested
+	done := make(chan struct{})
+	go func() {
+		auth.Refresh(&http.Response{})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("token request holds the lock")
+	}
+	close(release)
+	wg.Wait()
+	if issued != 1 {
+		t.Errorf("want 1 token request, got %d", issued)
+	}
+}
+
+func TestHMACAuth(t *testing.T) {
+	signer := NewHMACAuth("key", []byte("secret"), "Content-Type")
+	signer.Now = func() time.Time {
+		return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+	verifier := NewHMACAuth("key", []byte("secret"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := verifier.Verify(r); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, err)
+			return
+		}
+		fmt.Fprint(w, r.Header.Get("X-Date"))
+	}))
+	defer server.Close()
+
+	c := NewCrawler(1, WithAuth(signer))
+	c.Start()
+	defer c.Stop()
+	r, _ := NewRequest("POST", server.URL+"/path?b=2&a=1", strings.NewReader(`{"a": 1}`))
+	r.Request().Header.Set("Content-Type", "application/json")
+	c.Push(context.Background(), r)
+	res := <-c.Response()
+	if res.Error() != nil {
+		t.Fatal(res.Error())
+	}
+	body := readBody(res)
+	if res.Response().StatusCode != http.StatusOK || body != "20200102T030405Z" {
+		t.Errorf("invalid signature: %d %s", res.Response().StatusCode, body)
+	}
+	// signed copy of the request is sent
+	if !strings.Contains(res.Response().Request.Header.Get("Authorization"), "SignedHeaders=content-type;host;x-content-sha256;x-date") {
+		t.Errorf("invalid authorization: %s", res.Response().Request.Header.Get("Authorization"))
+	}
+	if res.Request().Header.Get("Authorization") != "" || res.Request().Header.Get("X-Date") != "" {
+		t.Errorf("signature stored with the request: %v", res.Request().Header)
+	}
+
+	other := NewHMACAuth("key", []byte("other"))
+	if res := crawlOne(t, server.URL, WithAuth(other)); res.Response().StatusCode != http.StatusForbidden {
+		t.Errorf("invalid secret accepted")
+	}
+}
+
+// crawlBody sends single Request to the server and returns Response body.
+func crawlBody(t *testing.T, url string, opts ...Option) string {
+	c := NewCrawler(1, opts...)
+	c.Start()
+	defer c.Stop()
+	r, _ := NewRequest("GET", url, nil)
+	c.Push(context.Background(), r)
+	select {
+	case res := <-c.Response():
+		if res.Error() != nil {
+			t.Fatal(res.Error())
+		}
+		return readBody(res)
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout")
+	}
+	return ""
+}
+
+func readBody(r Response) string {
+	var b strings.Builder
+	defer r.Response().Body.Close()
+	buf := make([]byte, 512)
+	for {
+		n, err := r.Response().Body.Read(buf)
+		b.Write(buf[:n])
+		if err != nil {
+			return b.String()
+		}
+	}
+}
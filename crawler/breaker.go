@@ -0,0 +1,246 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CircuitState is a state of the Breaker circuit of a single host.
+type CircuitState string
+
+const (
+	// CircuitClosed lets all requests through.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen rejects all requests until cool-down passes.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets single probe request through,
+	// if it succeeds circuit is closed, otherwise its opened again.
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// BreakerMode describes what happens with requests rejected by the Breaker.
+type BreakerMode int
+
+const (
+	// BreakerFail fails Request with ErrorCircuitOpen, without sending it.
+	BreakerFail BreakerMode = iota
+	// BreakerDefer sends Request back into the Queue once cool-down passes.
+	BreakerDefer
+)
+
+// ErrorCircuitOpen is an error of requests rejected by the Breaker.
+type ErrorCircuitOpen string
+
+func (e ErrorCircuitOpen) Error() string {
+	return fmt.Sprintf("circuit open for host %s", string(e))
+}
+
+// BreakerFailure reports whether Response counts as a failure of the host.
+// Canceled requests, requests rejected by the Breaker and responses
+// with too large body are not failures of the host.
+var BreakerFailure = func(r Response) bool {
+	var open ErrorCircuitOpen
+	if errors.As(r.Error(), &open) {
+		return false
+	}
+	if r.Error() != nil {
+		switch ResponseErrorClass(r) {
+		case ClassCanceled, ClassBodyTooLarge:
+			return false
+		}
+		return true
+	}
+	return r.Response() != nil && r.Response().StatusCode >= 500
+}
+
+// Breaker is a per host circuit breaker.
+// Host circuit is opened after threshold of consecutive failures
+// and half-opened after cool-down.
+type Breaker struct {
+	sync.Mutex
+
+	threshold int
+	cooldown  time.Duration
+	mode      BreakerMode
+	hosts     map[string]*circuit
+}
+
+// Circuit is a state of the circuit of a single host.
+type Circuit struct {
+	State    CircuitState `json:"state"`
+	Failures int          `json:"failures,omitempty"`
+	Opened   time.Time    `json:"opened,omitempty"`
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	opened   time.Time
+	probe    time.Time
+}
+
+// NewBreaker creates new Breaker.
+func NewBreaker(threshold int, cooldown time.Duration, mode BreakerMode) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		mode:      mode,
+		hosts:     map[string]*circuit{},
+	}
+}
+
+// WithBreaker rejects requests to hosts with open circuit.
+var WithBreaker = func(b *Breaker) Option {
+	return func(c *Crawler) {
+		c.breaker = b
+		c.OnRequest(func(i int, c *Crawler, r Request) error {
+			host := r.Request().URL.Host
+			wait, ok := b.allow(c, i, host)
+			if ok {
+				return nil
+			}
+			err := ErrorCircuitOpen(host)
+			switch b.mode {
+			case BreakerDefer:
+				// retried request is not abandoned by Seen
+				request := &retried{BaseRequest{request: r.Request(), depth: RequestDepth(r)}}
+				c.emit(Payload{Event: RetryEvent, Worker: i, Request: request, Error: err, Value: host})
+				// Stop waits for the goroutine
+				c.Add(1)
+				c.deferred.Add(1)
+				go func() {
+					defer c.Done()
+					defer c.deferred.Add(-1)
+					select {
+					case <-time.After(wait):
+					case <-c.ctx.Done():
+						return
+					}
+					if err := c.Push(c.ctx, request); err != nil && c.ctx.Err() == nil {
+						c.Print("deferred ", request.request.URL, " failed: ", err)
+					}
+				}()
+			default:
+				return &ErrorFail{Err: err}
+			}
+			return err
+		})
+		c.OnResponse(func(i int, c *Crawler, r Response) error {
+			b.record(c, i, r.Request().URL.Host, BreakerFailure(r))
+			return nil
+		})
+	}
+}
+
+// State returns state of the host circuit.
+func (b *Breaker) State(host string) CircuitState {
+	defer b.Unlock()
+	b.Lock()
+	if h, ok := b.hosts[host]; ok {
+		return h.state
+	}
+	return CircuitClosed
+}
+
+// Circuits returns circuits of all hosts.
+func (b *Breaker) Circuits() map[string]Circuit {
+	defer b.Unlock()
+	b.Lock()
+	circuits := make(map[string]Circuit, len(b.hosts))
+	for host, h := range b.hosts {
+		circuits[host] = Circuit{State: h.state, Failures: h.failures, Opened: h.opened}
+	}
+	return circuits
+}
+
+// RestoreCircuits replaces circuits of all hosts.
+// Half-opened circuits let next probe request through.
+func (b *Breaker) RestoreCircuits(circuits map[string]Circuit) {
+	defer b.Unlock()
+	b.Lock()
+	b.hosts = make(map[string]*circuit, len(circuits))
+	for host, h := range circuits {
+		b.hosts[host] = &circuit{state: h.State, failures: h.Failures, opened: h.Opened}
+	}
+}
+
+// allow reports whether request to the host can be sent,
+// if not it returns time left until the circuit is half-opened.
+func (b *Breaker) allow(c *Crawler, i int, host string) (time.Duration, bool) {
+	b.Lock()
+	h, ok := b.hosts[host]
+	if !ok {
+		h = &circuit{state: CircuitClosed}
+		b.hosts[host] = h
+	}
+	switch h.state {
+	case CircuitOpen:
+		if left := b.cooldown - time.Since(h.opened); left > 0 {
+			b.Unlock()
+			return left, false
+		}
+		h.state, h.probe = CircuitHalfOpen, time.Now()
+		b.Unlock()
+		c.emit(Payload{Event: BreakerHalfOpened, Worker: i, Value: host})
+		return 0, true
+	case CircuitHalfOpen:
+		defer b.Unlock()
+		// probe can be abandoned before it receives Response
+		// so another probe is allowed after cool-down
+		if left := b.cooldown - time.Since(h.probe); left > 0 {
+			return left, false
+		}
+		h.probe = time.Now()
+		return 0, true
+	}
+	b.Unlock()
+	return 0, true
+}
+
+// record updates host circuit with the result of a request.
+func (b *Breaker) record(c *Crawler, i int, host string, failure bool) {
+	b.Lock()
+	h, ok := b.hosts[host]
+	if !ok {
+		b.Unlock()
+		return
+	}
+	var e Event
+	switch {
+	case h.state == CircuitHalfOpen && failure:
+		h.state, h.opened = CircuitOpen, time.Now()
+		e = BreakerOpened
+	case h.state == CircuitHalfOpen:
+		h.state, h.failures = CircuitClosed, 0
+		e = BreakerClosed
+	case h.state == CircuitClosed && failure:
+		h.failures++
+		if h.failures >= b.threshold {
+			h.state, h.opened = CircuitOpen, time.Now()
+			e = BreakerOpened
+		}
+	case h.state == CircuitClosed:
+		h.failures = 0
+	}
+	b.Unlock()
+	if e != "" {
+		c.emit(Payload{Event: e, Worker: i, Value: host})
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestBreaker(t *testing.T) {
+	var mu sync.Mutex
+	var healthy bool
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !healthy {
+			w.WriteHeader(503)
+		}
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer good.Close()
+	badHost := mustHost(bad.URL)
+
+	var events []Event
+	var record = func(e Event, c *Crawler) {
+		events = append(events, e)
+	}
+	breaker := NewBreaker(2, time.Millisecond*100, BreakerFail)
+	c := NewCrawler(1, WithBreaker(breaker), WithLoggerOutput(ioutil.Discard))
+	c.OnEvent(BreakerOpened, record)
+	c.OnEvent(BreakerHalfOpened, record)
+	c.OnEvent(BreakerClosed, record)
+	c.OnEvent(DropEvent, record)
+	c.Start()
+
+	var do = func(u string) Response {
+		r, _ := NewRequest("GET", u, nil)
+		c.Push(context.Background(), r)
+		return <-c.Response()
+	}
+
+	for i := 0; i < 2; i++ {
+		if res := do(bad.URL); res.Error() != nil || res.Response().StatusCode != 503 {
+			t.Fatal("request not sent")
+		}
+	}
+	if breaker.State(badHost) != CircuitOpen {
+		t.Errorf("circuit not opened: %s", breaker.State(badHost))
+	}
+	var open ErrorCircuitOpen
+	errs := c.Errors().Size()
+	if res := do(bad.URL); !errors.As(res.Error(), &open) {
+		t.Errorf("want ErrorCircuitOpen, got: %v", res.Error())
+	}
+	// rejected request goes through the response pipeline
+	if c.Errors().Size() != errs+1 || c.Requests().Size() != c.Responses().Size() {
+		t.Errorf("rejected request not counted: %d errors, %d requests, %d responses",
+			c.Errors().Size(), c.Requests().Size(), c.Responses().Size())
+	}
+	if res := do(good.URL); res.Error() != nil {
+		t.Errorf("good host rejected: %v", res.Error())
+	}
+
+	// probe fails
+	time.Sleep(time.Millisecond * 100)
+	if res := do(bad.URL); res.Error() != nil {
+		t.Errorf("probe rejected: %v", res.Error())
+	}
+	if breaker.State(badHost) != CircuitOpen {
+		t.Errorf("circuit not opened: %s", breaker.State(badHost))
+	}
+
+	// probe succeeds
+	mu.Lock()
+	healthy = true
+	mu.Unlock()
+	time.Sleep(time.Millisecond * 100)
+	do(bad.URL)
+	if breaker.State(badHost) != CircuitClosed {
+		t.Errorf("circuit not closed: %s", breaker.State(badHost))
+	}
+	c.Stop()
+	c.Wait()
+
+	want := []Event{BreakerOpened, BreakerHalfOpened, BreakerOpened, BreakerHalfOpened, BreakerClosed}
+	if len(events) != len(want) {
+		t.Fatalf("want events: %v, got: %v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("want events: %v, got: %v", want, events)
+		}
+	}
+}
+
+func TestBreakerDefer(t *testing.T) {
+	var serverCounter = NewCounter()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverCounter.Add(1)
+		if serverCounter.Size() == 1 {
+			w.WriteHeader(500)
+		}
+	}))
+	defer ts.Close()
+
+	breaker := NewBreaker(1, time.Millisecond*100, BreakerDefer)
+	c := NewCrawler(1, WithBreaker(breaker), WithLoggerOutput(ioutil.Discard))
+	c.Start()
+
+	for i := 0; i < 2; i++ {
+		r, _ := NewRequest("GET", ts.URL, nil)
+		c.Push(context.Background(), r)
+	}
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		<-c.Response()
+	}
+	if took := time.Since(start); took < time.Millisecond*100 {
+		t.Errorf("request not deferred: %s", took)
+	}
+	if serverCounter.Size() != 2 {
+		t.Errorf("want 2 requests, got: %v", serverCounter.Size())
+	}
+	c.Stop()
+	c.Wait()
+}
+
+func TestBreakerDeferSeen(t *testing.T) {
+	var served = NewCounter()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(500)
+		}
+	}))
+	defer ts.Close()
+
+	breaker := NewBreaker(1, time.Millisecond*200, BreakerDefer)
+	c := NewCrawler(1, WithQueue(NewBufferedQueue(10)), WithSeen(NewSeen()), WithBreaker(breaker), WithLoggerOutput(ioutil.Discard))
+	for _, path := range []string{"/fail", "/deferred"} {
+		r, _ := NewRequest("GET", ts.URL+path, nil)
+		c.Push(context.Background(), r)
+	}
+	c.Start()
+	// deferred request is not abandoned by Seen and crawl is not completed
+	// while it waits for cool-down
+	var got []string
+	err := c.Consume(context.Background(), func(ctx context.Context, r Response) error {
+		got = append(got, r.Request().URL.Path)
+		return nil
+	}, 1, WithConsumeIdle(time.Millisecond*50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1] != "/deferred" || served.Size() != 2 {
+		t.Errorf("deferred request not performed: %v", got)
+	}
+	if c.Deferred() != 0 {
+		t.Errorf("want no deferred requests, got: %v", c.Deferred())
+	}
+}
+
+func mustHost(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		panic(err)
+	}
+	return parsed.Host
+}
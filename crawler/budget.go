@@ -0,0 +1,348 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Budget is a name of a limit bounding the crawl.
+type Budget string
+
+const (
+	// BudgetRequests limits total number of requests.
+	BudgetRequests Budget = "requests"
+	// BudgetDomainRequests limits number of requests sent to a single domain.
+	BudgetDomainRequests Budget = "domain_requests"
+	// BudgetDepth limits depth of requests.
+	BudgetDepth Budget = "depth"
+	// BudgetBytes limits total number of bytes read from response bodies.
+	BudgetBytes Budget = "bytes"
+	// BudgetDuration limits wall-clock duration of the crawl.
+	BudgetDuration Budget = "duration"
+)
+
+// ErrorBudgetExhausted is returned by OnRequest function when Request exceeds the Budget.
+type ErrorBudgetExhausted Budget
+
+func (e ErrorBudgetExhausted) Error() string {
+	return fmt.Sprintf("budget %s exhausted", string(e))
+}
+
+// budget tracks usage of the crawl budgets.
+// Requests, bytes and duration budgets stop the Crawler once they are exhausted,
+// domain requests and depth budgets only abandon requests exceeding them.
+type budget struct {
+	sync.Mutex
+
+	maxRequests       int
+	maxDomainRequests int
+	maxDepth          int
+	maxBytes          int64
+	maxDuration       time.Duration
+
+	requests  int
+	domains   map[string]int
+	bytes     int64
+	exhausted Budget
+	once      sync.Once
+	// reserved are hosts of requests allowed by the budget
+	// that are not counted until all OnRequest functions allowed them
+	reserved map[*http.Request]string
+	// elapsed is a duration of the crawl before it was last started
+	elapsed time.Duration
+	started time.Time
+	// running is count of started crawlers sharing the budget,
+	// duration of the crawl is measured while any of them runs
+	running int
+	// stop stops crawling once budget is exhausted,
+	// by default Crawler that exhausted it is stopped.
+	stop func(c *Crawler, name Budget)
+}
+
+// BudgetUsage is a usage of crawl budgets.
+type BudgetUsage struct {
+	Requests  int            `json:"requests"`
+	Domains   map[string]int `json:"domains,omitempty"`
+	Bytes     int64          `json:"bytes"`
+	Elapsed   time.Duration  `json:"elapsed"`
+	Exhausted Budget         `json:"exhausted,omitempty"`
+}
+
+// Exhausted returns Budget that stopped the Crawler or empty string.
+func (c *Crawler) Exhausted() Budget {
+	if c.budget == nil {
+		return ""
+	}
+	defer c.budget.Unlock()
+	c.budget.Lock()
+	return c.budget.exhausted
+}
+
+var WithMaxRequests = func(n int) Option {
+	return withBudget(func(b *budget) {
+		b.maxRequests = n
+	})
+}
+
+var WithMaxDomainRequests = func(n int) Option {
+	return withBudget(func(b *budget) {
+		b.maxDomainRequests = n
+	})
+}
+
+var WithMaxDepth = func(n int) Option {
+	return withBudget(func(b *budget) {
+		b.maxDepth = n
+	})
+}
+
+var WithMaxBytes = func(n int64) Option {
+	return withBudget(func(b *budget) {
+		b.maxBytes = n
+	})
+}
+
+var WithMaxDuration = func(d time.Duration) Option {
+	return withBudget(func(b *budget) {
+		b.maxDuration = d
+	})
+}
+
+// withBudget modifies budget of the Crawler.
+// Budget functions are registered when budget is created.
+func withBudget(f func(b *budget)) Option {
+	return func(c *Crawler) {
+		if c.budget != nil {
+			f(c.budget)
+			return
+		}
+		b := newBudget()
+		f(b)
+		c.budget = b
+		b.install(c)
+	}
+}
+
+// newBudget creates budget without limits.
+func newBudget() *budget {
+	return &budget{domains: map[string]int{}, reserved: map[*http.Request]string{}}
+}
+
+// install registers functions enforcing budget on the Crawler.
+// Budget can be installed on many crawlers, so it's shared between them.
+// Request is counted once all OnRequest functions allowed it.
+func (b *budget) install(c *Crawler) {
+	var stop = make(chan struct{})
+	var started bool
+	c.OnEvent(Started, func(e Event, c *Crawler) {
+		b.Lock()
+		if b.running == 0 {
+			b.started = time.Now()
+		}
+		b.running++
+		started = true
+		left := b.maxDuration - b.elapsed - time.Since(b.started)
+		b.Unlock()
+		if b.maxDuration <= 0 {
+			return
+		}
+		go func() {
+			select {
+			case <-stop:
+			case <-time.After(left):
+				b.exhaust(c, BudgetDuration)
+			}
+		}()
+	})
+	c.OnEvent(Stop, func(e Event, c *Crawler) {
+		close(stop)
+		b.Lock()
+		if started {
+			b.running--
+		}
+		if b.running == 0 && !b.started.IsZero() {
+			b.elapsed += time.Since(b.started)
+			b.started = time.Time{}
+		}
+		b.Unlock()
+	})
+	c.OnRequest(func(i int, c *Crawler, r Request) error {
+		return b.request(c, r)
+	})
+	c.Subscribe(RequestEvent, func(p Payload) {
+		b.sent(c, p.Request)
+	})
+	c.Subscribe(DropEvent, func(p Payload) {
+		b.dropped(p.Request)
+	})
+	// Request that panicked is counted by the Crawler as well
+	c.Subscribe(PanicEvent, func(p Payload) {
+		b.Lock()
+		delete(b.reserved, p.Request.Request())
+		b.Unlock()
+	})
+	c.OnResponse(func(i int, c *Crawler, r Response) error {
+		if res := r.Response(); res != nil && res.Body != nil && b.maxBytes > 0 {
+			res.Body = &budgetReader{ReadCloser: res.Body, budget: b, crawler: c}
+		}
+		return nil
+	})
+}
+
+// request reserves Request in the budget or returns error if it exceeds the budget.
+func (b *budget) request(c *Crawler, r Request) error {
+	b.Lock()
+	if b.exhausted != "" {
+		defer b.Unlock()
+		return ErrorBudgetExhausted(b.exhausted)
+	}
+	if b.maxBytes > 0 && b.bytes >= b.maxBytes {
+		b.Unlock()
+		return b.exhaust(c, BudgetBytes)
+	}
+	defer b.Unlock()
+	if b.maxDepth > 0 && RequestDepth(r) > b.maxDepth {
+		return ErrorBudgetExhausted(BudgetDepth)
+	}
+	// reserved requests that are dropped by other OnRequest
+	// functions are given back, so they do not exhaust the budget
+	if b.maxRequests > 0 && b.requests >= b.maxRequests {
+		return ErrorBudgetExhausted(BudgetRequests)
+	}
+	host := r.Request().URL.Hostname()
+	if b.maxDomainRequests > 0 && b.domains[host] >= b.maxDomainRequests {
+		return ErrorBudgetExhausted(BudgetDomainRequests)
+	}
+	b.requests++
+	b.domains[host]++
+	b.reserved[r.Request()] = host
+	return nil
+}
+
+// sent counts Request allowed by all OnRequest functions.
+// Requests failed before budget reserved them are counted as well.
+func (b *budget) sent(c *Crawler, r Request) {
+	b.Lock()
+	if _, ok := b.reserved[r.Request()]; ok {
+		delete(b.reserved, r.Request())
+	} else {
+		b.requests++
+		b.domains[r.Request().URL.Hostname()]++
+	}
+	last := b.maxRequests > 0 && b.requests >= b.maxRequests
+	b.Unlock()
+
+	// last allowed Request is still performed
+	if last {
+		b.exhaust(c, BudgetRequests)
+	}
+}
+
+// dropped gives back Request reserved in the budget.
+func (b *budget) dropped(r Request) {
+	defer b.Unlock()
+	b.Lock()
+	host, ok := b.reserved[r.Request()]
+	if !ok {
+		return
+	}
+	delete(b.reserved, r.Request())
+	b.requests--
+	if b.domains[host]--; b.domains[host] == 0 {
+		delete(b.domains, host)
+	}
+}
+
+func (b *budget) read(c *Crawler, n int) {
+	b.Lock()
+	b.bytes += int64(n)
+	exhausted := b.bytes >= b.maxBytes
+	b.Unlock()
+	if exhausted {
+		b.exhaust(c, BudgetBytes)
+	}
+}
+
+// exhaust marks Budget as exhausted, stops the Crawler and closes its Queue,
+// so producers pushing requests do not block. Only first exhausted Budget is recorded.
+func (b *budget) exhaust(c *Crawler, name Budget) error {
+	b.once.Do(func() {
+		b.Lock()
+		b.exhausted = name
+		b.Unlock()
+		if b.stop != nil {
+			b.stop(c, name)
+			return
+		}
+		c.emit(Payload{Event: BudgetExhausted, Worker: -1, Value: name})
+		c.Close()
+		// Stop waits for all goroutines to return
+		// and this can be called from one of them
+		go c.Stop()
+	})
+	defer b.Unlock()
+	b.Lock()
+	return ErrorBudgetExhausted(b.exhausted)
+}
+
+// usage returns BudgetUsage of the budget.
+func (b *budget) usage() BudgetUsage {
+	defer b.Unlock()
+	b.Lock()
+	u := BudgetUsage{
+		Requests:  b.requests,
+		Domains:   make(map[string]int, len(b.domains)),
+		Bytes:     b.bytes,
+		Elapsed:   b.elapsed,
+		Exhausted: b.exhausted,
+	}
+	for host, n := range b.domains {
+		u.Domains[host] = n
+	}
+	if !b.started.IsZero() {
+		u.Elapsed += time.Since(b.started)
+	}
+	return u
+}
+
+// restore replaces usage of the budget.
+func (b *budget) restore(u BudgetUsage) {
+	defer b.Unlock()
+	b.Lock()
+	b.requests, b.bytes, b.elapsed, b.exhausted = u.Requests, u.Bytes, u.Elapsed, u.Exhausted
+	b.domains = make(map[string]int, len(u.Domains))
+	for host, n := range u.Domains {
+		b.domains[host] = n
+	}
+}
+
+// budgetReader counts bytes read from response body.
+type budgetReader struct {
+	io.ReadCloser
+	budget  *budget
+	crawler *Crawler
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.budget.read(r.crawler, n)
+	return n, err
+}
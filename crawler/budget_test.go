@@ -0,0 +1,126 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestBudget(t *testing.T) {
+	var serverCounter = NewCounter()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverCounter.Add(1)
+		w.Write(bytes.Repeat([]byte("x"), 100))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		depth    int
+		want     Budget
+		wantSent int
+	}{
+		{name: "requests", opts: []Option{WithMaxRequests(3)}, want: BudgetRequests, wantSent: 3},
+		{name: "bytes", opts: []Option{WithMaxBytes(150)}, want: BudgetBytes, wantSent: 2},
+		{name: "duration", opts: []Option{WithMaxDuration(time.Millisecond * 100), WithMaxDomainRequests(4)}, want: BudgetDuration, wantSent: 4},
+		{name: "depth", opts: []Option{WithMaxDuration(time.Millisecond * 100), WithMaxDepth(1)}, depth: 2, want: BudgetDuration, wantSent: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverCounter = NewCounter()
+			opts := append(tt.opts, WithQueue(NewBufferedQueue(10)), WithLoggerOutput(ioutil.Discard))
+			c := NewCrawler(1, opts...)
+			// bodies are read before next request is sent, so budget usage is exact
+			c.OnResponse(func(i int, c *Crawler, r Response) error {
+				b, _ := ioutil.ReadAll(r.Response().Body)
+				r.Response().Body = ioutil.NopCloser(bytes.NewReader(b))
+				return nil
+			})
+
+			var parent Request
+			for i := 0; i < 10; i++ {
+				r, _ := NewRequest("GET", ts.URL, nil)
+				if i%2 == 0 {
+					for d := 0; d < tt.depth; d++ {
+						r, _ = NewChildRequest(r, "GET", ts.URL, nil)
+					}
+				}
+				parent = r
+				c.Push(context.Background(), parent)
+			}
+			go func() {
+				for r := range c.Response() {
+					ioutil.ReadAll(r.Response().Body)
+				}
+			}()
+			c.Start()
+			c.Wait()
+
+			if c.Exhausted() != tt.want {
+				t.Errorf("want %s, got: %s", tt.want, c.Exhausted())
+			}
+			// exhausted budget closes the Queue, so producers do not block
+			r, _ := NewRequest("GET", ts.URL, nil)
+			if err := c.Push(context.Background(), r); err != ErrorQueueClosed {
+				t.Errorf("want ErrorQueueClosed, got: %v", err)
+			}
+			if n := serverCounter.Size(); n != tt.wantSent {
+				t.Errorf("want %v requests, got: %v", tt.wantSent, serverCounter.Size())
+			}
+		})
+	}
+}
+
+func TestBudgetDropped(t *testing.T) {
+	var served = NewCounter()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+	}))
+	defer ts.Close()
+
+	c := NewCrawler(1, WithMaxRequests(2), WithQueue(NewBufferedQueue(10)), WithLoggerOutput(ioutil.Discard))
+	// requests dropped after the budget allowed them are not counted
+	c.OnRequest(func(i int, c *Crawler, r Request) error {
+		if r.Request().URL.Path == "/drop" {
+			return errors.New("dropped")
+		}
+		return nil
+	})
+	for _, path := range []string{"/drop", "/a", "/drop", "/b", "/c"} {
+		r, _ := NewRequest("GET", ts.URL+path, nil)
+		c.Push(context.Background(), r)
+	}
+	drain(c, nil)
+	c.Start()
+	c.Wait()
+
+	if c.Exhausted() != BudgetRequests {
+		t.Errorf("want %s, got: %s", BudgetRequests, c.Exhausted())
+	}
+	if n := served.Size(); n != 2 {
+		t.Errorf("want 2 requests, got: %v", n)
+	}
+}
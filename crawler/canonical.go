@@ -0,0 +1,393 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultTrackingParams are query parameters removed by default Canonicalizer.
+// Parameters ending with * match by prefix.
+var DefaultTrackingParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "msclkid", "mc_cid", "mc_eid", "_ga",
+	"sessionid", "session_id", "sid", "jsessionid", "phpsessid", "aspsessionid",
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// Canonicalizer normalizes urls, so different urls of the same resource are equal:
+// scheme and host are lowercased, default port is removed, international host
+// is converted to punycode, dot segments are resolved, percent-encoding is
+// normalized, query parameters are sorted and tracking parameters and fragment are removed.
+type Canonicalizer struct {
+	tracking []string
+	fragment bool
+}
+
+type CanonicalOption = func(c *Canonicalizer)
+
+// WithTrackingParams sets query parameters removed from urls, parameter names are case insensitive.
+var WithTrackingParams = func(params ...string) CanonicalOption {
+	return func(c *Canonicalizer) {
+		c.tracking = params
+	}
+}
+
+// WithFragment keeps url fragment.
+var WithFragment = func() CanonicalOption {
+	return func(c *Canonicalizer) {
+		c.fragment = true
+	}
+}
+
+// NewCanonicalizer creates new Canonicalizer removing DefaultTrackingParams.
+func NewCanonicalizer(opts ...CanonicalOption) *Canonicalizer {
+	c := &Canonicalizer{tracking: DefaultTrackingParams}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Canonicalize returns canonical url using default Canonicalizer.
+var Canonicalize = func(rawurl string) (string, error) {
+	return NewCanonicalizer().String(rawurl)
+}
+
+// CanonicalKey returns key identifying Request by its canonical url.
+// It can be used as RequestKey.
+var CanonicalKey = func(r Request) string {
+	return r.Request().Method + " " + NewCanonicalizer().URL(r.Request().URL).String()
+}
+
+// String returns canonical form of rawurl.
+func (c *Canonicalizer) String(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	return c.URL(u).String(), nil
+}
+
+// URL returns canonical copy of u.
+func (c *Canonicalizer) URL(u *url.URL) *url.URL {
+	cu := *u
+	cu.Scheme = strings.ToLower(u.Scheme)
+	if u.User != nil {
+		user := *u.User
+		cu.User = &user
+	}
+
+	if u.Host != "" {
+		host, port := u.Hostname(), u.Port()
+		host = strings.TrimSuffix(strings.ToLower(host), ".")
+		if ip := net.ParseIP(host); ip == nil {
+			host = punycodeHost(host)
+		} else if strings.Contains(host, ":") {
+			host = "[" + ip.String() + "]"
+		}
+		if port != "" && port != defaultPorts[cu.Scheme] {
+			host += ":" + port
+		}
+		cu.Host = host
+	}
+
+	if cu.Opaque == "" {
+		p := removeDotSegments(normalizeEscapes(c.stripPathParams(u.EscapedPath())))
+		if p == "" && cu.Host != "" {
+			p = "/"
+		}
+		cu.RawPath = p
+		cu.Path, _ = url.PathUnescape(p)
+		if cu.Path == p {
+			cu.RawPath = ""
+		}
+	}
+
+	cu.RawQuery = c.query(u.RawQuery)
+	cu.ForceQuery = false
+	if !c.fragment {
+		cu.Fragment, cu.RawFragment = "", ""
+	}
+	return &cu
+}
+
+// tracked reports whether query parameter should be removed.
+func (c *Canonicalizer) tracked(name string) bool {
+	name = strings.ToLower(name)
+	for _, t := range c.tracking {
+		t = strings.ToLower(t)
+		if strings.HasSuffix(t, "*") {
+			if strings.HasPrefix(name, t[:len(t)-1]) {
+				return true
+			}
+		} else if name == t {
+			return true
+		}
+	}
+	return false
+}
+
+// stripPathParams removes tracked path parameters, like ;jsessionid=123.
+func (c *Canonicalizer) stripPathParams(p string) string {
+	i := strings.IndexByte(p, ';')
+	if i < 0 {
+		return p
+	}
+	segments := strings.Split(p, "/")
+	for n, s := range segments {
+		parts := strings.Split(s, ";")
+		kept := parts[:1]
+		for _, param := range parts[1:] {
+			if !c.tracked(strings.SplitN(param, "=", 2)[0]) {
+				kept = append(kept, param)
+			}
+		}
+		segments[n] = strings.Join(kept, ";")
+	}
+	return strings.Join(segments, "/")
+}
+
+func (c *Canonicalizer) query(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	var params []string
+	for _, param := range strings.Split(raw, "&") {
+		if param == "" {
+			continue
+		}
+		name := param
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			name = param[:i]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if c.tracked(name) {
+			continue
+		}
+		params = append(params, normalizeEscapes(param))
+	}
+	sort.Stable(byName(params))
+	return strings.Join(params, "&")
+}
+
+// byName sorts query parameters by name, keeping order of values of the same parameter.
+type byName []string
+
+func (p byName) Len() int      { return len(p) }
+func (p byName) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byName) Less(i, j int) bool {
+	return strings.SplitN(p[i], "=", 2)[0] < strings.SplitN(p[j], "=", 2)[0]
+}
+
+// removeDotSegments resolves . and .. segments of the path as described in RFC 3986 5.2.4.
+func removeDotSegments(p string) string {
+	if !strings.Contains(p, ".") {
+		return p
+	}
+	var out []string
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		last := i == len(segments)-1
+		switch s {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 1 || (len(out) == 1 && out[0] != "") {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, s)
+		}
+	}
+	if strings.HasPrefix(p, "/") && (len(out) == 0 || out[0] != "") {
+		out = append([]string{""}, out...)
+	}
+	if len(out) == 1 && out[0] == "" {
+		return "/"
+	}
+	return strings.Join(out, "/")
+}
+
+// normalizeEscapes decodes percent-encoded unreserved characters,
+// uppercases remaining escapes and escapes characters that are not allowed in urls.
+func normalizeEscapes(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			v := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if unreserved(v) {
+				b.WriteByte(v)
+			} else {
+				b.WriteByte('%')
+				b.WriteByte(hex[v>>4])
+				b.WriteByte(hex[v&15])
+			}
+			i += 2
+			continue
+		}
+		if ch == '%' || ch <= ' ' || ch >= 0x7f || strings.IndexByte(`"<>\^`+"`{|}", ch) >= 0 {
+			b.WriteByte('%')
+			b.WriteByte(hex[ch>>4])
+			b.WriteByte(hex[ch&15])
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+func unreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// punycodeHost converts international labels of the host into punycode.
+func punycodeHost(host string) string {
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if !utf8.ValidString(label) {
+			continue
+		}
+		for _, r := range label {
+			if r >= utf8.RuneSelf {
+				labels[i] = "xn--" + punycode(label)
+				break
+			}
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// punycode encodes label as described in RFC 3492.
+func punycode(label string) string {
+	const (
+		base        = 36
+		tmin        = 1
+		tmax        = 26
+		skew        = 38
+		damp        = 700
+		initialBias = 72
+		initialN    = 128
+	)
+	digit := func(d int) byte {
+		if d < 26 {
+			return byte('a' + d)
+		}
+		return byte('0' + d - 26)
+	}
+	adapt := func(delta, points int, first bool) int {
+		if first {
+			delta /= damp
+		} else {
+			delta /= 2
+		}
+		delta += delta / points
+		k := 0
+		for delta > ((base-tmin)*tmax)/2 {
+			delta /= base - tmin
+			k += base
+		}
+		return k + (base-tmin+1)*delta/(delta+skew)
+	}
+
+	runes := []rune(label)
+	var out []byte
+	for _, r := range runes {
+		if r < initialN {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := initialN, 0, initialBias
+	for handled < len(runes) {
+		m := int(^uint(0) >> 1)
+		for _, r := range runes {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+		delta += (m - n) * (handled + 1)
+		n = m
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+			}
+			if int(r) != n {
+				continue
+			}
+			q := delta
+			for k := base; ; k += base {
+				t := k - bias
+				if t < tmin {
+					t = tmin
+				} else if t > tmax {
+					t = tmax
+				}
+				if q < t {
+					break
+				}
+				out = append(out, digit(t+(q-t)%(base-t)))
+				q = (q - t) / (base - t)
+			}
+			out = append(out, digit(q))
+			bias = adapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"testing"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"HTTP://Example.COM:80", "http://example.com/"},
+		{"https://example.com:443/a", "https://example.com/a"},
+		{"https://example.com:8443/a", "https://example.com:8443/a"},
+		{"http://example.com./a/./b/../c/", "http://example.com/a/c/"},
+		{"http://example.com/a/b/..", "http://example.com/a/"},
+		{"http://example.com/../../a", "http://example.com/a"},
+		{"http://example.com/a#section", "http://example.com/a"},
+		{"http://example.com/?b=2&a=1&b=1", "http://example.com/?a=1&b=2&b=1"},
+		{"http://example.com/?utm_source=x&q=go&fbclid=1&UTM_Medium=y", "http://example.com/?q=go"},
+		{"http://example.com/?utm_source=x", "http://example.com/"},
+		{"http://example.com/a;jsessionid=123?x=1", "http://example.com/a?x=1"},
+		{"http://example.com/%7euser/%2f%41", "http://example.com/~user/%2FA"},
+		{"http://example.com/?q=%e2%82%ac", "http://example.com/?q=%E2%82%AC"},
+		{"http://münchen.de/", "http://xn--mnchen-3ya.de/"},
+		{"http://bücher.例え.jp/", "http://xn--bcher-kva.xn--r8jz45g.jp/"},
+		{"http://[2001:DB8:0:0::1]:80/", "http://[2001:db8::1]/"},
+	}
+	for _, tt := range tests {
+		got, err := Canonicalize(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: want %s, got %s", tt.url, tt.want, got)
+		}
+	}
+}
+
+func TestCanonicalizerOptions(t *testing.T) {
+	c := NewCanonicalizer(WithTrackingParams("ref", "x_*"), WithFragment())
+	got, err := c.String("http://example.com/?utm_source=a&ref=b&x_id=1#top")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://example.com/?utm_source=a#top"; got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestCanonicalKey(t *testing.T) {
+	a, _ := NewRequest("GET", "http://EXAMPLE.com/a?b=1&a=2&utm_source=x", nil)
+	b, _ := NewRequest("GET", "http://example.com:80/./a?a=2&b=1#frag", nil)
+	if CanonicalKey(a) != CanonicalKey(b) {
+		t.Errorf("keys differ: %s %s", CanonicalKey(a), CanonicalKey(b))
+	}
+}
+
+func TestWithRequestKey(t *testing.T) {
+	a, _ := NewRequest("GET", "http://example.com/a?utm_source=x", nil)
+	b, _ := NewRequest("GET", "http://example.com/a", nil)
+	c := NewCrawler(1, WithRequestKey(CanonicalKey))
+	if c.RequestKey(a) != c.RequestKey(b) {
+		t.Errorf("keys differ: %s %s", c.RequestKey(a), c.RequestKey(b))
+	}
+	// other crawlers keep default RequestKey
+	if c := NewCrawler(1); c.RequestKey(a) == c.RequestKey(b) || RequestKey(a) == RequestKey(b) {
+		t.Error("default RequestKey changed")
+	}
+}
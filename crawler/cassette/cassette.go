@@ -0,0 +1,350 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// Mode describes how Cassette handles requests.
+type Mode int
+
+const (
+	// Record performs requests with underlying transport and saves each exchange.
+	Record Mode = iota
+	// Replay responds with previously recorded exchanges without touching the network.
+	Replay
+)
+
+// Unmatched describes what Cassette does when replayed request does not match any recorded one.
+type Unmatched int
+
+const (
+	// UnmatchedError fails the request with ErrorUnmatched.
+	UnmatchedError Unmatched = iota
+	// UnmatchedPassthrough performs the request with underlying transport.
+	UnmatchedPassthrough
+	// UnmatchedRecord performs the request with underlying transport and records it.
+	UnmatchedRecord
+)
+
+// ErrorUnmatched is returned when request does not match any recorded Interaction.
+type ErrorUnmatched string
+
+func (e ErrorUnmatched) Error() string {
+	return fmt.Sprintf("cassette: no recorded interaction for %s", string(e))
+}
+
+// Interaction is a single recorded exchange.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded http.Request.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// Response is a recorded http.Response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Proto      string      `json:"proto"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+type Option = func(c *Cassette)
+
+// WithTransport sets transport used to perform real requests.
+var WithTransport = func(t http.RoundTripper) Option {
+	return func(c *Cassette) {
+		c.transport = t
+	}
+}
+
+// WithMatchers replaces rules used to match requests against recorded interactions.
+var WithMatchers = func(m ...Matcher) Option {
+	return func(c *Cassette) {
+		c.matchers = m
+	}
+}
+
+// WithRedactedHeaders replaces headers whose values are not stored in the Cassette,
+// by default they are Authorization, Proxy-Authorization, Cookie and Set-Cookie.
+// Values of redacted headers are replaced with Redacted, so they cannot be matched
+// with MatchHeaders.
+var WithRedactedHeaders = func(names ...string) Option {
+	return func(c *Cassette) {
+		c.redacted = names
+	}
+}
+
+// Redacted replaces values of redacted headers.
+const Redacted = "REDACTED"
+
+// WithUnmatched sets behaviour for requests not matching any recorded interaction.
+var WithUnmatched = func(u Unmatched) Option {
+	return func(c *Cassette) {
+		c.unmatched = u
+	}
+}
+
+// Cassette is a http.RoundTripper that records and replays exchanges.
+// Use it with crawler.WithClient(cassette.Client()).
+type Cassette struct {
+	sync.Mutex
+
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+	matchers  []Matcher
+	unmatched Unmatched
+	redacted  []string
+
+	interactions []Interaction
+	replayed     []bool
+}
+
+// New creates new Cassette stored at path.
+// In Replay mode interactions are loaded from path.
+func New(path string, mode Mode, opts ...Option) (*Cassette, error) {
+	c := &Cassette{
+		path:      path,
+		mode:      mode,
+		transport: http.DefaultTransport,
+		matchers:  []Matcher{MatchMethod, MatchURL},
+		unmatched: UnmatchedError,
+		redacted:  []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if mode == Replay {
+		if err := c.load(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Client returns http.Client using Cassette as transport.
+func (c *Cassette) Client() *http.Client {
+	return &http.Client{Transport: c}
+}
+
+// Interactions returns copy of recorded interactions.
+func (c *Cassette) Interactions() []Interaction {
+	defer c.Unlock()
+	c.Lock()
+	interactions := make([]Interaction, len(c.interactions))
+	copy(interactions, c.interactions)
+	return interactions
+}
+
+// RoundTrip implements http.RoundTripper.
+// Request is not modified, its body is read from GetBody or from a copy.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, out, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if c.mode == Record {
+		return c.record(req, out, body)
+	}
+	if i, ok := c.find(req, body); ok {
+		closeBody(out)
+		return i.Response.response(req), nil
+	}
+	switch c.unmatched {
+	case UnmatchedPassthrough:
+		return c.transport.RoundTrip(out)
+	case UnmatchedRecord:
+		return c.record(req, out, body)
+	}
+	closeBody(out)
+	return nil, ErrorUnmatched(req.Method + " " + req.URL.String())
+}
+
+// Save writes recorded interactions into file.
+func (c *Cassette) Save() error {
+	b, err := json.MarshalIndent(c.Interactions(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, b, 0644)
+}
+
+func (c *Cassette) load() error {
+	b, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &c.interactions); err != nil {
+		return err
+	}
+	c.replayed = make([]bool, len(c.interactions))
+	return nil
+}
+
+// record performs out, the request sent instead of req, and records the exchange.
+func (c *Cassette) record(req, out *http.Request, body []byte) (*http.Response, error) {
+	res, err := c.transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(b))
+	res.Request = req
+
+	defer c.Unlock()
+	c.Lock()
+	c.interactions = append(c.interactions, Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: c.redact(req.Header),
+			Body:   body,
+		},
+		Response: Response{
+			StatusCode: res.StatusCode,
+			Proto:      res.Proto,
+			Header:     c.redact(res.Header),
+			Body:       b,
+		},
+	})
+	c.replayed = append(c.replayed, true)
+	return res, nil
+}
+
+// find returns first not yet replayed Interaction matching the request.
+// When all matching interactions were replayed, the last one is reused.
+func (c *Cassette) find(req *http.Request, body []byte) (Interaction, bool) {
+	defer c.Unlock()
+	c.Lock()
+	var last = -1
+	for i, interaction := range c.interactions {
+		if !c.match(req, body, interaction.Request) {
+			continue
+		}
+		if !c.replayed[i] {
+			c.replayed[i] = true
+			return interaction, true
+		}
+		last = i
+	}
+	if last >= 0 {
+		return c.interactions[last], true
+	}
+	return Interaction{}, false
+}
+
+// redact returns copy of the header with values of redacted headers replaced.
+func (c *Cassette) redact(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range c.redacted {
+		if vv := h.Values(name); len(vv) > 0 {
+			redacted := make([]string, len(vv))
+			for i := range redacted {
+				redacted[i] = Redacted
+			}
+			h[http.CanonicalHeaderKey(name)] = redacted
+		}
+	}
+	return h
+}
+
+func (c *Cassette) match(req *http.Request, body []byte, r Request) bool {
+	for _, m := range c.matchers {
+		if !m(req, body, r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Response) response(req *http.Request) *http.Response {
+	major, minor, ok := http.ParseHTTPVersion(r.Proto)
+	if !ok {
+		major, minor = 1, 1
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         r.Proto,
+		ProtoMajor:    major,
+		ProtoMinor:    minor,
+		Header:        r.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// readBody reads request body and returns request to send instead of req.
+// Body is read from GetBody, so req can be sent, otherwise it's read
+// from req and copy of req with in-memory body is returned.
+func readBody(req *http.Request) ([]byte, *http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, req, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			closeBody(req)
+			return nil, nil, err
+		}
+		b, err := ioutil.ReadAll(body)
+		body.Close()
+		if err != nil {
+			closeBody(req)
+			return nil, nil, err
+		}
+		return b, req, nil
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	out := req.Clone(req.Context())
+	out.Body = ioutil.NopCloser(bytes.NewReader(b))
+	out.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+	return b, out, nil
+}
+
+// closeBody closes body of the request that is not sent,
+// as http.RoundTripper has to close it.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cassette_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bukowa/micro/crawler"
+	. "github.com/bukowa/micro/crawler/cassette"
+)
+
+func TestCassette(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.json")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Write(append([]byte(r.URL.Path+":"), b...))
+	}))
+
+	// record
+	recorder, err := New(path, Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := crawler.NewCrawler(2, crawler.WithClient(recorder.Client()))
+	c.Start()
+	for _, p := range []string{"/a", "/b"} {
+		req, _ := crawler.NewRequest("POST", ts.URL+p, strings.NewReader("body"))
+		c.Push(context.Background(), req)
+		res := <-c.Response()
+		if res.Error() != nil {
+			t.Fatal(res.Error())
+		}
+		res.Response().Body.Close()
+	}
+	c.Stop()
+	c.Wait()
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+	ts.Close()
+
+	// replay with server closed
+	player, err := New(path, Replay, WithMatchers(MatchMethod, MatchURL, MatchBody, MatchHeaders("X-Test")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = crawler.NewCrawler(1, crawler.WithClient(player.Client()))
+	c.Start()
+	for _, p := range []string{"/b", "/a"} {
+		req, _ := crawler.NewRequest("POST", ts.URL+p, strings.NewReader("body"))
+		c.Push(context.Background(), req)
+		res := <-c.Response()
+		if res.Error() != nil {
+			t.Fatal(res.Error())
+		}
+		b, _ := ioutil.ReadAll(res.Response().Body)
+		if string(b) != p+":body" {
+			t.Errorf("invalid body: %s", b)
+		}
+		if res.Response().Header.Get("X-Path") != p {
+			t.Errorf("invalid header: %s", res.Response().Header.Get("X-Path"))
+		}
+	}
+
+	// body does not match
+	req, _ := crawler.NewRequest("POST", ts.URL+"/a", strings.NewReader("other"))
+	c.Push(context.Background(), req)
+	res := <-c.Response()
+	var unmatched ErrorUnmatched
+	if !errors.As(res.Error(), &unmatched) {
+		t.Errorf("want ErrorUnmatched, got: %v", res.Error())
+	}
+	c.Stop()
+	c.Wait()
+}
+
+func TestCassetteRequest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.json")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	recorder, err := New(path, Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// body without GetBody is not replaced
+	req, _ := http.NewRequest("POST", ts.URL, ioutil.NopCloser(strings.NewReader("body")))
+	req.Header.Set("Authorization", "Bearer secret")
+	body := req.Body
+	res, err := recorder.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	if string(b) != "body" || req.Body != body {
+		t.Errorf("invalid round trip: %s", b)
+	}
+
+	// credentials are redacted
+	i := recorder.Interactions()[0]
+	if i.Request.Header.Get("Authorization") != Redacted || i.Response.Header.Get("Set-Cookie") != Redacted {
+		t.Errorf("credentials recorded: %v %v", i.Request.Header, i.Response.Header)
+	}
+	if string(i.Request.Body) != "body" {
+		t.Errorf("invalid recorded body: %s", i.Request.Body)
+	}
+
+	// proto is replayed
+	i.Response.Proto = "HTTP/2.0"
+	b, _ = json.Marshal([]Interaction{i})
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	player, err := New(path, Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ = http.NewRequest("POST", ts.URL, strings.NewReader("body"))
+	res, err = player.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ProtoMajor != 2 || res.ProtoMinor != 0 {
+		t.Errorf("invalid proto: %d.%d", res.ProtoMajor, res.ProtoMinor)
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cassette
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// Matcher reports whether request with body matches recorded Request.
+type Matcher = func(req *http.Request, body []byte, r Request) bool
+
+// MatchMethod matches request method.
+var MatchMethod Matcher = func(req *http.Request, body []byte, r Request) bool {
+	return req.Method == r.Method
+}
+
+// MatchURL matches full request url.
+var MatchURL Matcher = func(req *http.Request, body []byte, r Request) bool {
+	return req.URL.String() == r.URL
+}
+
+// MatchBody matches request body.
+var MatchBody Matcher = func(req *http.Request, body []byte, r Request) bool {
+	return bytes.Equal(body, r.Body)
+}
+
+// MatchHeaders matches values of given headers.
+var MatchHeaders = func(names ...string) Matcher {
+	return func(req *http.Request, body []byte, r Request) bool {
+		for _, name := range names {
+			if req.Header.Get(name) != r.Header.Get(name) {
+				return false
+			}
+		}
+		return true
+	}
+}
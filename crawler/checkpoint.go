@@ -0,0 +1,307 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Snapshot is a complete state of the crawl.
+type Snapshot struct {
+	Time       time.Time            `json:"time"`
+	Pending    []SnapshotRequest    `json:"pending"`
+	Seen       []string             `json:"seen,omitempty"`
+	Politeness map[string]time.Time `json:"politeness,omitempty"`
+	Requests   int                  `json:"requests"`
+	Responses  int                  `json:"responses"`
+	Errors     int                  `json:"errors"`
+	Panics     int                  `json:"panics,omitempty"`
+	// ErrorClasses are counts of errors by ErrorClass.
+	ErrorClasses map[ErrorClass]int `json:"error_classes,omitempty"`
+	Budget       *BudgetUsage       `json:"budget,omitempty"`
+	Breaker      map[string]Circuit `json:"breaker,omitempty"`
+}
+
+// SnapshotRequest is a serializable Request.
+type SnapshotRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+	Depth  int         `json:"depth,omitempty"`
+}
+
+// NewSnapshotRequest creates SnapshotRequest from Request.
+// Body of the request is read from its copy returned by GetBody,
+// if there is none, body is read and replaced with in-memory copy.
+func NewSnapshotRequest(r Request) (SnapshotRequest, error) {
+	req := r.Request()
+	s := SnapshotRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+		Depth:  RequestDepth(r),
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return s, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return s, err
+		}
+		defer body.Close()
+		s.Body, err = ioutil.ReadAll(body)
+		return s, err
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return s, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	s.Body = b
+	return s, nil
+}
+
+// ErrorNotSnapshotter is returned by Snapshot when Queue of the Crawler
+// cannot list its requests without removing them.
+var ErrorNotSnapshotter = errors.New("queue does not implement Snapshotter")
+
+// Restore creates Request from SnapshotRequest.
+func (s SnapshotRequest) Restore() (Request, error) {
+	var body io.Reader
+	if s.Body != nil {
+		body = bytes.NewReader(s.Body)
+	}
+	req, err := http.NewRequest(s.Method, s.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+	return &BaseRequest{request: req, depth: s.Depth}, nil
+}
+
+// Snapshot captures state of the Crawler.
+// Pending requests are listed by the Queue, which has to implement Snapshotter,
+// they stay in the Queue. Taking snapshot of a running Crawler is safe
+// but its best to do it once Crawler stopped.
+func (c *Crawler) Snapshot() (Snapshot, error) {
+	snapshotter, ok := c.Queue.(Snapshotter)
+	if !ok {
+		return Snapshot{}, ErrorNotSnapshotter
+	}
+	var s = Snapshot{
+		Time:      time.Now(),
+		Pending:   []SnapshotRequest{},
+		Requests:  c.Requests().Size(),
+		Responses: c.Responses().Size(),
+		Errors:    c.Errors().Size(),
+		Panics:    c.Panics().Size(),
+	}
+	if c.seen != nil {
+		s.Seen = c.seen.Keys()
+	}
+	if c.politeness != nil {
+		s.Politeness = c.politeness.State()
+	}
+	if sizes := c.ErrorClasses().Sizes(); len(sizes) > 0 {
+		s.ErrorClasses = sizes
+	}
+	if c.budget != nil {
+		u := c.budget.usage()
+		s.Budget = &u
+	}
+	if c.breaker != nil {
+		s.Breaker = c.breaker.Circuits()
+	}
+
+	pending, err := snapshotter.Pending()
+	if err != nil {
+		return s, err
+	}
+	for _, r := range pending {
+		sr, err := NewSnapshotRequest(r)
+		if err != nil {
+			return s, err
+		}
+		s.Pending = append(s.Pending, sr)
+	}
+	return s, nil
+}
+
+// Restore restores state of the Crawler from Snapshot.
+// Pending requests that do not fit into the Queue are sent in background
+// until they fit or the Crawler is stopped. Crawler restored with exhausted
+// budget is stopped like the one the Snapshot was taken from.
+func (c *Crawler) Restore(s Snapshot) error {
+	var pending []Request
+	for _, sr := range s.Pending {
+		r, err := sr.Restore()
+		if err != nil {
+			return err
+		}
+		pending = append(pending, r)
+	}
+
+	c.Requests().Add(s.Requests)
+	c.Responses().Add(s.Responses)
+	c.Errors().Add(s.Errors)
+	c.Panics().Add(s.Panics)
+	for class, n := range s.ErrorClasses {
+		c.ErrorClasses().Counter(class).Add(n)
+	}
+	if c.budget != nil && s.Budget != nil {
+		c.budget.restore(*s.Budget)
+	}
+	if c.breaker != nil && s.Breaker != nil {
+		c.breaker.RestoreCircuits(s.Breaker)
+	}
+	if c.seen != nil {
+		for _, key := range s.Seen {
+			c.seen.Add(key)
+		}
+	}
+	if c.politeness != nil && s.Politeness != nil {
+		c.politeness.Restore(s.Politeness)
+	}
+
+	defer func() {
+		if c.budget != nil && s.Budget != nil && s.Budget.Exhausted != "" {
+			c.budget.exhaust(c, s.Budget.Exhausted)
+		}
+	}()
+	for i, r := range pending {
+		switch err := c.TryPush(r); err {
+		case nil:
+		case ErrorQueueFull:
+			// Stop waits for the goroutine
+			c.Add(1)
+			go func(rest []Request) {
+				defer c.Done()
+				for _, r := range rest {
+					if c.Push(c.ctx, r) != nil {
+						return
+					}
+				}
+			}(pending[i:])
+			return nil
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckpointStore stores Snapshot.
+type CheckpointStore interface {
+	Save(Snapshot) error
+	Load() (Snapshot, error)
+}
+
+// NewFileCheckpoint creates CheckpointStore writing Snapshot as json into file.
+func NewFileCheckpoint(path string) CheckpointStore {
+	return &FileCheckpoint{path: path}
+}
+
+// FileCheckpoint implements CheckpointStore.
+type FileCheckpoint struct {
+	path string
+}
+
+// Save writes Snapshot into temporary file and renames it,
+// so the previous Snapshot is not lost when writing fails.
+func (f *FileCheckpoint) Save(s Snapshot) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// Load reads Snapshot from file.
+func (f *FileCheckpoint) Load() (s Snapshot, err error) {
+	b, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(b, &s)
+	return s, err
+}
+
+// WithCheckpoint saves Snapshot into store every interval while Crawler
+// is running and once again after Crawler stopped.
+// If interval is 0 Snapshot is saved only after Crawler stopped.
+var WithCheckpoint = func(store CheckpointStore, interval time.Duration) Option {
+	var save = func(c *Crawler) {
+		s, err := c.Snapshot()
+		if err == nil {
+			err = store.Save(s)
+		}
+		if err != nil {
+			c.Printf("checkpoint:err:%s", err)
+		}
+	}
+	return func(c *Crawler) {
+		var stop = make(chan struct{})
+		c.OnEvent(Started, func(e Event, c *Crawler) {
+			if interval <= 0 {
+				return
+			}
+			go func() {
+				ticker := time.NewTicker(interval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-stop:
+						return
+					case <-ticker.C:
+						save(c)
+					}
+				}
+			}()
+		})
+		c.OnEvent(Stop, func(e Event, c *Crawler) {
+			close(stop)
+		})
+		c.OnEvent(Stopped, func(e Event, c *Crawler) {
+			save(c)
+		})
+	}
+}
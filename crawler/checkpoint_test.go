@@ -0,0 +1,202 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestCheckpoint(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewFileCheckpoint(filepath.Join(dir, "snapshot.json"))
+
+	var newCrawler = func() *Crawler {
+		return NewCrawler(2,
+			WithSeen(NewSeen()),
+			WithPoliteness(NewPoliteness(time.Millisecond)),
+			WithCheckpoint(store, 0),
+			WithLoggerOutput(ioutil.Discard),
+		)
+	}
+
+	c := newCrawler()
+	c.Start()
+	for _, path := range []string{"/a", "/b", "/a"} {
+		r, _ := NewRequest("GET", ts.URL+path, nil)
+		c.Push(context.Background(), r)
+	}
+	<-c.Response()
+	<-c.Response()
+	c.Stop()
+	c.Wait()
+
+	s, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Requests != 2 || s.Responses != 2 || len(s.Seen) != 2 || len(s.Politeness) != 1 {
+		t.Errorf("invalid snapshot: %+v", s)
+	}
+
+	// pending requests
+	for _, path := range []string{"/a", "/c"} {
+		r, _ := NewRequest("GET", ts.URL+path, nil)
+		c.Push(context.Background(), r)
+	}
+	s, err = c.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Pending) != 2 || c.Len() != 2 {
+		t.Errorf("invalid pending requests: %v", s.Pending)
+	}
+
+	c2 := newCrawler()
+	if err := c2.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	c2.Start()
+	res := <-c2.Response()
+	if res.Request().URL.Path != "/c" {
+		t.Errorf("seen request crawled: %s", res.Request().URL)
+	}
+	c2.Stop()
+	c2.Wait()
+	if c2.Requests().Size() != 3 || c2.Responses().Size() != 3 {
+		t.Errorf("invalid counters: %v %v", c2.Requests().Size(), c2.Responses().Size())
+	}
+}
+
+func TestCheckpointState(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var newCrawler = func() *Crawler {
+		return NewCrawler(1,
+			WithMaxRequests(10),
+			WithBreaker(NewBreaker(1, time.Hour, BreakerDefer)),
+			WithLoggerOutput(ioutil.Discard),
+		)
+	}
+	c := newCrawler()
+	c.Start()
+	for _, u := range []string{ts.URL, "http://127.0.0.1:1/"} {
+		r, _ := NewRequest("GET", u, nil)
+		c.Push(context.Background(), r)
+		<-c.Response()
+	}
+	c.Stop()
+
+	s, err := c.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Budget == nil || s.Budget.Requests != 2 || len(s.Budget.Domains) != 1 || s.Budget.Elapsed <= 0 {
+		t.Errorf("invalid budget usage: %+v", s.Budget)
+	}
+	if s.ErrorClasses[ClassConnectionRefused] != 1 {
+		t.Errorf("invalid error classes: %v", s.ErrorClasses)
+	}
+	if s.Breaker["127.0.0.1:1"].State != CircuitOpen {
+		t.Errorf("invalid breaker: %v", s.Breaker)
+	}
+
+	c2 := newCrawler()
+	if err := c2.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	s2, err := c2.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2.Time = s.Time
+	b, _ := json.Marshal(s)
+	b2, _ := json.Marshal(s2)
+	if string(b) != string(b2) {
+		t.Errorf("restored snapshot differs:\n%s\n%s", b, b2)
+	}
+}
+
+func TestCheckpointQueue(t *testing.T) {
+	// requests stay in the Queue in the same order
+	q := NewQueue(3, 0)
+	c := NewCrawler(1, WithQueue(q), WithLoggerOutput(ioutil.Discard))
+	for _, path := range []string{"/a", "/b"} {
+		r, _ := NewRequest("GET", "http://localhost"+path, nil)
+		c.Push(context.Background(), r)
+	}
+	s, err := c.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Pending) != 2 || s.Pending[0].URL != "http://localhost/a" || c.Len() != 2 {
+		t.Errorf("invalid pending requests: %v", s.Pending)
+	}
+	r, _ := c.Pop(context.Background())
+	if r.Request().URL.Path != "/a" {
+		t.Errorf("invalid request: %s", r.Request().URL)
+	}
+	if s, _ := c.Snapshot(); len(s.Pending) != 1 {
+		t.Errorf("popped request is pending: %v", s.Pending)
+	}
+
+	// requests sent directly into the channel cannot be listed
+	base := NewBaseQueue(1, 0)
+	r, _ = NewRequest("GET", "http://localhost", nil)
+	base.Request() <- r
+	c = NewCrawler(1, WithQueue(AdaptQueue(base)), WithLoggerOutput(ioutil.Discard))
+	if _, err := c.Snapshot(); err != ErrorQueueUntracked {
+		t.Errorf("want ErrorQueueUntracked, got: %v", err)
+	}
+
+	c = NewCrawler(1, WithQueue(&stack{}), WithLoggerOutput(ioutil.Discard))
+	if _, err := c.Snapshot(); err != ErrorNotSnapshotter {
+		t.Errorf("want ErrorNotSnapshotter, got: %v", err)
+	}
+}
+
+func TestCheckpointExhausted(t *testing.T) {
+	c := NewCrawler(1, WithMaxRequests(1), WithLoggerOutput(ioutil.Discard))
+	s := Snapshot{Budget: &BudgetUsage{Requests: 1, Exhausted: BudgetRequests}}
+	if err := c.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-c.Context().Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("crawler with exhausted budget not stopped")
+	}
+	if c.Exhausted() != BudgetRequests {
+		t.Errorf("invalid exhausted budget: %v", c.Exhausted())
+	}
+}
@@ -0,0 +1,298 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// ErrorClass is a category of Response errors,
+// so retry, circuit breaker and reporting logic can branch on it.
+type ErrorClass string
+
+const (
+	// ClassNone is a class of responses without error.
+	ClassNone ErrorClass = ""
+	// ClassDNS is a failed host name lookup.
+	ClassDNS ErrorClass = "dns"
+	// ClassConnectionRefused is a connection refused by the host.
+	ClassConnectionRefused ErrorClass = "connection_refused"
+	// ClassConnectTimeout is a timeout while connecting to the host.
+	ClassConnectTimeout ErrorClass = "connect_timeout"
+	// ClassTLSTimeout is a timeout of TLS handshake.
+	ClassTLSTimeout ErrorClass = "tls_timeout"
+	// ClassHeaderTimeout is a timeout while waiting for response headers.
+	// Timeouts of unknown phase are header timeouts.
+	ClassHeaderTimeout ErrorClass = "header_timeout"
+	// ClassBodyTimeout is a timeout while reading response body.
+	ClassBodyTimeout ErrorClass = "body_timeout"
+	// ClassTLS is a failed TLS handshake or certificate verification.
+	ClassTLS ErrorClass = "tls"
+	// ClassTooManyRedirects is ErrorTooManyRedirects.
+	ClassTooManyRedirects ErrorClass = "too_many_redirects"
+	// ClassBodyTooLarge is ErrorBodyTooLarge.
+	ClassBodyTooLarge ErrorClass = "body_too_large"
+	// ClassCanceled is a Request canceled with its context.
+	ClassCanceled ErrorClass = "canceled"
+	// ClassPanic is ErrorPanic of recovered panic.
+	ClassPanic ErrorClass = "panic"
+	// ClassOther are all other errors.
+	ClassOther ErrorClass = "other"
+)
+
+// Timeout reports whether class is one of timeouts.
+func (c ErrorClass) Timeout() bool {
+	switch c {
+	case ClassConnectTimeout, ClassTLSTimeout, ClassHeaderTimeout, ClassBodyTimeout:
+		return true
+	}
+	return false
+}
+
+// Retryable reports whether Request failed with error of the class can succeed when it's retried.
+func (c ErrorClass) Retryable() bool {
+	return c.Timeout() || c == ClassConnectionRefused
+}
+
+// Classify returns ErrorClass of the error returned by http.Client or read from response body.
+func Classify(err error) ErrorClass {
+	return classify(err, nil)
+}
+
+// IsDNS reports whether err is a failed host name lookup.
+func IsDNS(err error) bool {
+	return Classify(err) == ClassDNS
+}
+
+// IsConnectionRefused reports whether connection was refused by the host.
+func IsConnectionRefused(err error) bool {
+	return Classify(err) == ClassConnectionRefused
+}
+
+// IsTimeout reports whether err is any of timeouts.
+func IsTimeout(err error) bool {
+	return Classify(err).Timeout()
+}
+
+// IsTLS reports whether TLS handshake or certificate verification failed.
+func IsTLS(err error) bool {
+	return Classify(err) == ClassTLS
+}
+
+// IsTooManyRedirects reports whether err is ErrorTooManyRedirects.
+func IsTooManyRedirects(err error) bool {
+	return Classify(err) == ClassTooManyRedirects
+}
+
+// IsBodyTooLarge reports whether err is ErrorBodyTooLarge.
+func IsBodyTooLarge(err error) bool {
+	return Classify(err) == ClassBodyTooLarge
+}
+
+// IsCanceled reports whether Request was canceled.
+func IsCanceled(err error) bool {
+	return Classify(err) == ClassCanceled
+}
+
+// ResponseErrorClass returns ErrorClass of the Response error.
+// Responses that implement ErrorClass() can classify timeouts more precisely.
+func ResponseErrorClass(r Response) ErrorClass {
+	if c, ok := r.(interface{ ErrorClass() ErrorClass }); ok {
+		return c.ErrorClass()
+	}
+	return Classify(r.Error())
+}
+
+// classify returns ErrorClass of the error,
+// phase of timeouts is taken from trace if it's known.
+func classify(err error, t *trace) ErrorClass {
+	if err == nil {
+		return ClassNone
+	}
+	var redirects ErrorTooManyRedirects
+	var large ErrorBodyTooLarge
+	var dns *net.DNSError
+	var panicked *ErrorPanic
+	switch {
+	case errors.As(err, &panicked):
+		return ClassPanic
+	case errors.As(err, &redirects):
+		return ClassTooManyRedirects
+	case errors.As(err, &large):
+		return ClassBodyTooLarge
+	case errors.Is(err, context.Canceled):
+		return ClassCanceled
+	case errors.As(err, &dns):
+		return ClassDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ClassConnectionRefused
+	case isTLS(err):
+		return ClassTLS
+	case isTimeout(err):
+		return timeout(err, t)
+	}
+	return ClassOther
+}
+
+// countBody counts the first error of reading the response body in ErrorClasses,
+// as body timeouts and ErrorBodyTooLarge of bodies without Content-Length
+// happen after the Response was sent.
+func (c *Crawler) countBody(request Request, t *trace, res *http.Response) {
+	if res == nil || res.Body == nil || res.Body == http.NoBody {
+		return
+	}
+	res.Body = &countedBody{ReadCloser: res.Body, crawler: c, request: request, trace: t}
+}
+
+// countedBody counts errors of reading the body, except errors after Close.
+type countedBody struct {
+	io.ReadCloser
+	crawler *Crawler
+	request Request
+	trace   *trace
+
+	mu     sync.Mutex
+	closed bool
+	failed bool
+}
+
+func (b *countedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	b.mu.Lock()
+	count := !b.closed && !b.failed
+	b.failed = true
+	b.mu.Unlock()
+	if count {
+		c := b.crawler
+		class := classify(err, b.trace)
+		c.ErrorClasses().Counter(class).Add(1)
+		c.emit(Payload{Event: ErrorEvent, Worker: -1, Request: b.request, Error: err, Value: class})
+	}
+	return n, err
+}
+
+func (b *countedBody) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	return b.ReadCloser.Close()
+}
+
+func isTLS(err error) bool {
+	var unknown x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var alert tls.RecordHeaderError
+	if errors.As(err, &unknown) || errors.As(err, &hostname) || errors.As(err, &invalid) || errors.As(err, &alert) {
+		return true
+	}
+	// handshake errors of crypto/tls are not typed
+	return strings.Contains(err.Error(), "tls: ")
+}
+
+// isTimeout reports whether any of wrapped errors is a timeout,
+// wrappers like url.Error report only timeouts of errors they wrap directly.
+func isTimeout(err error) bool {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if t, ok := e.(interface{ Timeout() bool }); ok && t.Timeout() {
+			return true
+		}
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// timeout returns class of the timeout, first from error message of the http.Transport,
+// then from failed operation and finally from phase of the trace.
+func timeout(err error, t *trace) ErrorClass {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "TLS handshake timeout"):
+		return ClassTLSTimeout
+	case strings.Contains(msg, "awaiting response headers"), strings.Contains(msg, "awaiting headers"):
+		return ClassHeaderTimeout
+	case strings.Contains(msg, "reading body"):
+		return ClassBodyTimeout
+	}
+	var op *net.OpError
+	if errors.As(err, &op) && op.Op == "dial" {
+		return ClassConnectTimeout
+	}
+	if t != nil {
+		return t.phase()
+	}
+	return ClassHeaderTimeout
+}
+
+// phase returns class of timeout happening in the current phase of the trace.
+func (t *trace) phase() ErrorClass {
+	defer t.Unlock()
+	t.Lock()
+	switch {
+	case !t.dns.IsZero() && t.timing.DNS == 0, !t.connect.IsZero() && t.timing.Connect == 0:
+		return ClassConnectTimeout
+	case !t.handshake.IsZero() && t.timing.TLSHandshake == 0:
+		return ClassTLSTimeout
+	case !t.headers.IsZero():
+		return ClassBodyTimeout
+	}
+	return ClassHeaderTimeout
+}
+
+// ErrorCounters counts errors by ErrorClass.
+type ErrorCounters struct {
+	sync.Mutex
+	counters map[ErrorClass]Counter
+}
+
+// NewErrorCounters creates new ErrorCounters.
+func NewErrorCounters() *ErrorCounters {
+	return &ErrorCounters{counters: map[ErrorClass]Counter{}}
+}
+
+// Counter returns Counter of the class.
+func (e *ErrorCounters) Counter(class ErrorClass) Counter {
+	defer e.Unlock()
+	e.Lock()
+	c, ok := e.counters[class]
+	if !ok {
+		c = NewCounter()
+		e.counters[class] = c
+	}
+	return c
+}
+
+// Sizes returns counts of errors of each class that happened.
+func (e *ErrorCounters) Sizes() map[ErrorClass]int {
+	defer e.Unlock()
+	e.Lock()
+	sizes := map[ErrorClass]int{}
+	for class, c := range e.counters {
+		sizes[class] = c.Size()
+	}
+	return sizes
+}
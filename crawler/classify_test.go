@@ -0,0 +1,155 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassify(t *testing.T) {
+	var wrap = func(err error) error {
+		return &url.Error{Op: "Get", URL: "http://localhost", Err: err}
+	}
+	var tests = []struct {
+		err  error
+		want ErrorClass
+	}{
+		{nil, ClassNone},
+		{wrap(&net.DNSError{Err: "no such host", Name: "a.invalid"}), ClassDNS},
+		{wrap(&net.OpError{Op: "dial", Err: timeoutError{}}), ClassConnectTimeout},
+		{wrap(fmt.Errorf("net/http: TLS handshake timeout: %w", timeoutError{})), ClassTLSTimeout},
+		{wrap(fmt.Errorf("net/http: timeout awaiting response headers: %w", timeoutError{})), ClassHeaderTimeout},
+		{wrap(&net.OpError{Op: "read", Err: timeoutError{}}), ClassHeaderTimeout},
+		{wrap(ErrorTooManyRedirects(10)), ClassTooManyRedirects},
+		{ErrorBodyTooLarge(10), ClassBodyTooLarge},
+		{wrap(context.Canceled), ClassCanceled},
+		{&ErrorPanic{Value: "panic"}, ClassPanic},
+		{wrap(errors.New("EOF")), ClassOther},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("%v: want %q, got %q", tt.err, tt.want, got)
+		}
+	}
+	if !IsTimeout(wrap(&net.OpError{Op: "dial", Err: timeoutError{}})) || IsTimeout(wrap(context.Canceled)) {
+		t.Error("invalid timeout predicate")
+	}
+	if !ClassConnectionRefused.Retryable() || ClassTLS.Retryable() {
+		t.Error("invalid retryable classes")
+	}
+}
+
+func TestClassifyNetwork(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/body" {
+			w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer secure.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/", http.StatusFound)
+	}))
+	defer redirect.Close()
+	large := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 100)))
+	}))
+	defer large.Close()
+	refused := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	refused.Close()
+
+	var timeout = WithClient(&http.Client{Timeout: time.Millisecond * 100, Transport: &http.Transport{}})
+	var tests = []struct {
+		name string
+		url  string
+		opts []Option
+		want ErrorClass
+	}{
+		{"refused", refused.URL, nil, ClassConnectionRefused},
+		{"header timeout", slow.URL, []Option{timeout}, ClassHeaderTimeout},
+		{"tls", secure.URL, nil, ClassTLS},
+		{"redirects", redirect.URL, []Option{WithMaxRedirects(2)}, ClassTooManyRedirects},
+		{"body too large", large.URL, []Option{WithMaxBodySize(10)}, ClassBodyTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCrawler(1, append(tt.opts, WithLoggerOutput(ioutil.Discard))...)
+			var events = make(chan Payload, 1)
+			c.Subscribe(ErrorEvent, func(p Payload) {
+				events <- p
+			})
+			c.Start()
+			defer c.Stop()
+			r, _ := NewRequest("GET", tt.url, nil)
+			c.Push(context.Background(), r)
+			res := <-c.Response()
+			if got := ResponseErrorClass(res); got != tt.want {
+				t.Errorf("want %q, got %q: %v", tt.want, got, res.Error())
+			}
+			if p := <-events; p.Value != tt.want {
+				t.Errorf("invalid event value: %v", p.Value)
+			}
+			if sizes := c.ErrorClasses().Sizes(); sizes[tt.want] != 1 || len(sizes) != 1 {
+				t.Errorf("invalid counters: %v", sizes)
+			}
+		})
+	}
+
+	// body errors are read by consumers
+	if err := readBodyError(slow.URL+"/body", timeout); Classify(err) != ClassBodyTimeout {
+		t.Errorf("want body timeout, got %v", err)
+	}
+}
+
+// readBodyError crawls url and returns error of the Response or error of reading its body.
+func readBodyError(url string, opts ...Option) error {
+	c := NewCrawler(1, append(opts, WithLoggerOutput(ioutil.Discard))...)
+	c.Start()
+	defer c.Stop()
+	r, _ := NewRequest("GET", url, nil)
+	c.Push(context.Background(), r)
+	res := <-c.Response()
+	if res.Error() != nil {
+		return res.Error()
+	}
+	defer res.Response().Body.Close()
+	_, err := ioutil.ReadAll(res.Response().Body)
+	return err
+}
@@ -0,0 +1,268 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Handler handles Response received by Consume.
+// Body of the Response is closed once Handler returns.
+type Handler = func(ctx context.Context, r Response) error
+
+// ConsumePolicy decides what Consume does when Handler returned an error.
+type ConsumePolicy int
+
+const (
+	// ConsumeIgnore ignores errors of the Handler.
+	ConsumeIgnore ConsumePolicy = iota
+	// ConsumeStop stops the Crawler and returns the error from Consume.
+	// Responses left are abandoned.
+	ConsumeStop
+	// ConsumeRetry sends Request of the Response back into the Queue.
+	// Request is not abandoned by Seen and once retries are exhausted the error is ignored.
+	// Requests that do not fit into the full Queue and Requests with body
+	// that cannot be read again (without GetBody) are not retried.
+	ConsumeRetry
+)
+
+// ErrorBodyNotReusable is logged when retried Request has body without GetBody.
+var ErrorBodyNotReusable = errors.New("request body cannot be read again")
+
+type ConsumeOption = func(c *consumer)
+
+// WithConsumePolicy sets ConsumePolicy of Handler errors, by default errors are ignored.
+var WithConsumePolicy = func(p ConsumePolicy) ConsumeOption {
+	return func(c *consumer) {
+		c.policy = p
+	}
+}
+
+// WithConsumeRetries sets how many times Request is retried with ConsumeRetry policy.
+var WithConsumeRetries = func(n int) ConsumeOption {
+	return func(c *consumer) {
+		c.retries = n
+	}
+}
+
+// WithConsumeIdle sets how long Crawler has to be idle before crawl is completed.
+var WithConsumeIdle = func(t time.Duration) ConsumeOption {
+	return func(c *consumer) {
+		c.idle = t
+	}
+}
+
+// Consume sends responses to parallelism goroutines executing Handler, until crawl completes.
+// Crawl is completed when Queue is empty and no Request or Response was processed
+// for idle time, then Crawler is stopped and Consume returns nil. It's also completed
+// when Crawler was stopped, responses sent before workers returned are still handled.
+// If ctx is done or Handler error stopped the Crawler, responses left are abandoned
+// and ctx or Handler error is returned. Consume has to be called after Start.
+func (c *Crawler) Consume(ctx context.Context, handler Handler, parallelism int, opts ...ConsumeOption) error {
+	cs := &consumer{
+		crawler:  c,
+		handler:  handler,
+		retries:  3,
+		idle:     time.Millisecond * 500,
+		attempts: map[*http.Request]int{},
+		abort:    make(chan struct{}),
+		discard:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(cs)
+	}
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	var stopped = make(chan struct{})
+	var handlers sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+			for {
+				select {
+				case r := <-c.Response():
+					cs.handle(ctx, r)
+				case <-stopped:
+					return
+				}
+			}
+		}()
+	}
+
+	err := cs.wait(ctx)
+	if err != nil {
+		close(cs.discard)
+	}
+	// responses are received while workers are returning
+	c.Stop()
+	close(stopped)
+	handlers.Wait()
+	for {
+		select {
+		case r := <-c.Response():
+			cs.handle(ctx, r)
+		default:
+			return err
+		}
+	}
+}
+
+// consumer holds state of Consume.
+type consumer struct {
+	sync.Mutex
+
+	crawler *Crawler
+	handler Handler
+	policy  ConsumePolicy
+	retries int
+	idle    time.Duration
+
+	attempts map[*http.Request]int
+	busy     int
+	handled  int
+	err      error
+
+	abort   chan struct{}
+	discard chan struct{}
+	once    sync.Once
+}
+
+// wait waits until crawl is completed, ctx is done or Crawler was stopped.
+func (cs *consumer) wait(ctx context.Context) error {
+	tick := cs.idle / 4
+	if tick < time.Millisecond {
+		tick = time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	c := cs.crawler
+	var since time.Time
+	var last = -1
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-cs.abort:
+			return cs.err
+		case <-c.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+		cs.Lock()
+		busy, progress := cs.busy, cs.handled
+		cs.Unlock()
+		progress += c.Requests().Size() + c.Responses().Size()
+		if busy > 0 || progress != last || c.Active() > 0 || c.Deferred() > 0 || c.Len() > 0 || len(c.Response()) > 0 {
+			since, last = time.Time{}, progress
+			continue
+		}
+		if since.IsZero() {
+			since = time.Now()
+		} else if time.Since(since) >= cs.idle {
+			return nil
+		}
+	}
+}
+
+// handle executes Handler and closes body of the Response.
+// Abandoned responses are only closed.
+func (cs *consumer) handle(ctx context.Context, r Response) {
+	defer func() {
+		if res := r.Response(); res != nil && res.Body != nil {
+			res.Body.Close()
+		}
+	}()
+	select {
+	case <-cs.discard:
+		return
+	default:
+	}
+
+	cs.Lock()
+	cs.busy++
+	cs.Unlock()
+	err := cs.handler(ctx, r)
+	if cs.finish(r, err) {
+		cs.retry(r, err)
+	}
+}
+
+// finish records result of the handler and reports whether Request should be retried.
+func (cs *consumer) finish(r Response, err error) bool {
+	defer cs.Unlock()
+	cs.Lock()
+	cs.busy--
+	cs.handled++
+	if err == nil {
+		delete(cs.attempts, r.Request())
+		return false
+	}
+
+	switch cs.policy {
+	case ConsumeStop:
+		cs.once.Do(func() {
+			cs.err = err
+			close(cs.abort)
+		})
+	case ConsumeRetry:
+		req := r.Request()
+		if cs.attempts[req] >= cs.retries {
+			delete(cs.attempts, req)
+			return false
+		}
+		cs.attempts[req]++
+		return true
+	}
+	return false
+}
+
+// retry pushes Request of the Response failed by handler back to the Queue.
+func (cs *consumer) retry(r Response, err error) {
+	c := cs.crawler
+	req := r.Request()
+	switch {
+	case req.GetBody != nil:
+		body, err := req.GetBody()
+		if err != nil {
+			c.Print("retry of ", req.URL, " failed: ", err)
+			return
+		}
+		req.Body = body
+	case req.Body != nil && req.Body != http.NoBody:
+		// body was read by the sent request
+		c.Print("retry of ", req.URL, " failed: ", ErrorBodyNotReusable)
+		return
+	}
+	request := &retried{BaseRequest{request: req, depth: RequestDepth(r)}}
+	c.emit(Payload{Event: RetryEvent, Worker: -1, Request: request, Response: r, Error: err})
+	// handlers must not block on full Queue, as workers wait for them
+	if err := c.TryPush(request); err != nil {
+		c.Print("retry of ", req.URL, " failed: ", err)
+	}
+}
+
+// retried is a Request sent into the Queue again, it's not abandoned by Seen.
+type retried struct {
+	BaseRequest
+}
@@ -0,0 +1,229 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+// closeBody records if body of the Response was closed.
+type closeBody struct {
+	io.ReadCloser
+	closed *int32Counter
+}
+
+type int32Counter struct {
+	sync.Mutex
+	n int
+}
+
+func (b closeBody) Close() error {
+	b.closed.Lock()
+	b.closed.n++
+	b.closed.Unlock()
+	return b.ReadCloser.Close()
+}
+
+func TestConsume(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var closed = &int32Counter{}
+	c := NewCrawler(2, WithSeen(NewSeen()), WithLoggerOutput(ioutil.Discard),
+		WithResponseFunc(func(c *Crawler, took time.Duration, req Request, res *http.Response, err error) Response {
+			if res != nil {
+				res.Body = closeBody{ReadCloser: res.Body, closed: closed}
+			}
+			return NewResponse(c, took, req, res, err)
+		}))
+	c.Start()
+	r, _ := NewRequest("GET", ts.URL+"/0", nil)
+	c.Push(context.Background(), r)
+
+	// each page links to the next one up to 9
+	var mu sync.Mutex
+	var handled = map[string]bool{}
+	err := c.Consume(context.Background(), func(ctx context.Context, r Response) error {
+		mu.Lock()
+		handled[r.Request().URL.Path] = true
+		n := len(handled)
+		mu.Unlock()
+		if n < 10 {
+			child, _ := NewChildRequest(r, "GET", fmt.Sprintf("%s/%d", ts.URL, n), nil)
+			return c.Push(ctx, child)
+		}
+		return nil
+	}, 3, WithConsumeIdle(time.Millisecond*50))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handled) != 10 {
+		t.Errorf("want 10 responses, got %d", len(handled))
+	}
+	if closed.n != 10 {
+		t.Errorf("want 10 closed bodies, got %d", closed.n)
+	}
+	if c.Context().Err() == nil {
+		t.Error("crawler was not stopped")
+	}
+}
+
+func TestConsumePolicy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var failure = errors.New("failure")
+	var tests = []struct {
+		name    string
+		policy  ConsumePolicy
+		err     error
+		handled int
+	}{
+		{"ignore", ConsumeIgnore, nil, 1},
+		{"stop", ConsumeStop, failure, 1},
+		{"retry", ConsumeRetry, nil, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCrawler(1, WithSeen(NewSeen()), WithLoggerOutput(ioutil.Discard))
+			var retries = make(chan Payload, 10)
+			c.Subscribe(RetryEvent, func(p Payload) {
+				retries <- p
+			})
+			c.Start()
+			r, _ := NewRequest("GET", ts.URL, nil)
+			c.Push(context.Background(), r)
+
+			var handled int
+			err := c.Consume(context.Background(), func(ctx context.Context, r Response) error {
+				handled++
+				return failure
+			}, 1, WithConsumePolicy(tt.policy), WithConsumeRetries(2), WithConsumeIdle(time.Millisecond*50))
+			if err != tt.err {
+				t.Errorf("want %v, got %v", tt.err, err)
+			}
+			if handled != tt.handled {
+				t.Errorf("want %d handled, got %d", tt.handled, handled)
+			}
+			if len(retries) != tt.handled-1 {
+				t.Errorf("want %d retries, got %d", tt.handled-1, len(retries))
+			}
+		})
+	}
+}
+
+func TestConsumeRetryBody(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	var tests = []struct {
+		name    string
+		body    io.Reader
+		handled int
+	}{
+		{"reusable", strings.NewReader("body"), 2},
+		// body without GetBody is read once
+		{"read once", ioutil.NopCloser(strings.NewReader("body")), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bodies = nil
+			c := NewCrawler(1, WithLoggerOutput(ioutil.Discard))
+			c.Start()
+			r, _ := NewRequest("POST", ts.URL, tt.body)
+			c.Push(context.Background(), r)
+
+			var handled int
+			c.Consume(context.Background(), func(ctx context.Context, r Response) error {
+				handled++
+				return errors.New("failure")
+			}, 1, WithConsumePolicy(ConsumeRetry), WithConsumeRetries(1), WithConsumeIdle(time.Millisecond*50))
+			if handled != tt.handled {
+				t.Errorf("want %d handled, got %d", tt.handled, handled)
+			}
+			for _, b := range bodies {
+				if b != "body" {
+					t.Errorf("invalid body %q", b)
+				}
+			}
+		})
+	}
+}
+
+func TestConsumeContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	c := NewCrawler(2, WithQueue(NewBufferedQueue(10)), WithLoggerOutput(ioutil.Discard))
+	c.Start()
+	for i := 0; i < 10; i++ {
+		r, _ := NewRequest("GET", ts.URL, nil)
+		c.Push(context.Background(), r)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	err := c.Consume(ctx, func(ctx context.Context, r Response) error {
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	}, 1)
+	if err != context.Canceled {
+		t.Errorf("want context canceled, got %v", err)
+	}
+	if c.Context().Err() == nil {
+		t.Error("crawler was not stopped")
+	}
+}
+
+func TestConsumeStopped(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	// budget stops the crawler, responses sent before are handled
+	c := NewCrawler(1, WithQueue(NewBufferedQueue(10)), WithMaxRequests(3), WithLoggerOutput(ioutil.Discard))
+	c.Start()
+	for i := 0; i < 10; i++ {
+		r, _ := NewRequest("GET", ts.URL, nil)
+		c.Push(context.Background(), r)
+	}
+	var handled int
+	err := c.Consume(context.Background(), func(ctx context.Context, r Response) error {
+		handled++
+		return nil
+	}, 1, WithConsumeIdle(time.Second*10))
+	if err != nil || handled != 3 {
+		t.Errorf("want 3 handled, got %d %v", handled, err)
+	}
+}
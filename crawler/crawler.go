@@ -16,6 +16,8 @@ limitations under the License.
 package crawler
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"sync"
 	"time"
@@ -31,15 +33,34 @@ type Crawler struct {
 	sync.WaitGroup
 
 	size   int
-	stop   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
 	sleep  time.Duration
 	client *http.Client
 
+	stopOnce  sync.Once
+	panics    Counter
+	active    Counter
+	deferred  Counter
+	maxPanics int
+
+	seen       Seen
+	requestKey func(r Request) string
+	politeness Politeness
+	budget     *budget
+	breaker    *Breaker
+	redirects  redirects
+	tls        *tlsSettings
+	auth       map[string]Auth
+	maxBody    int64
+	classes    *ErrorCounters
+
 	newRespFunc NewResponseFunc
+	responses   chan Response
 
 	onRequest []func(int, *Crawler, Request) error
 	onResponse []func(int, *Crawler, Response) error
-	events map[Event][]func(Event, *Crawler)
+	events map[Event][]*subscriber
 }
 
 // NewResponseFunc is a function used by crawler to create new Response.
@@ -54,9 +75,7 @@ func NewCrawler(size int, opts ...Option) *Crawler {
 		Logger:  NewLogger(),
 		sleep:   time.Millisecond,
 		size:    size,
-		// non-buffered channel
-		stop:    make(chan struct{}),
-		events:  map[Event][]func(Event, *Crawler){},
+		events:  map[Event][]*subscriber{},
 		// client is modified to avoid networking problems
 		// while testing with default http client there are issues
 		client: &http.Client{Transport: &http.Transport{
@@ -68,10 +87,24 @@ func NewCrawler(size int, opts ...Option) *Crawler {
 			IdleConnTimeout:     time.Second * 2,
 		}},
 		newRespFunc: NewResponse,
+		panics:      NewCounter(),
+		active:      NewCounter(),
+		deferred:    NewCounter(),
+		classes:     NewErrorCounters(),
+		redirects:   redirects{max: 10},
 	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
 	for _, opt := range opts {
 		opt(c)
 	}
+	c.applyTLS()
+	c.client = c.redirectClient(c.client)
+	// adapted channel queues receive responses
+	if q, ok := c.Queue.(ChanQueue); ok {
+		c.responses = q.Response()
+	} else {
+		c.responses = make(chan Response, size)
+	}
 	return c
 }
 
@@ -92,54 +125,23 @@ func (c *Crawler) Start() {
 			// notify started
 			started <- struct{}{}
 
-			RequestLoop:
 			for {
-				select {
-				case <-c.stop:
+				request, err := c.Pop(c.ctx)
+				switch {
+				case err == nil:
+					c.active.Add(1)
+					c.process(i, request)
+					c.active.Add(-1)
+				case c.ctx.Err() != nil:
+					return
+				case err == ErrorQueueClosed:
+					// nothing more to crawl, wait for Stop
+					<-c.ctx.Done()
 					return
-				case request := <-c.Request():
-
-					// execute OnRequest functions
-					// if any of them returns error, cancel Request
-					for _, f := range c.onRequest {
-						if err := f(i, c, request); err != nil {
-							goto RequestLoop
-						}
-					}
-
-					// increment requests count
-					c.Requests().Add(1)
-					c.event(RequestEvent)
-
-					// perform http request
-					start := time.Now()
-					responseHTTP, err := c.client.Do(request.Request())
-					took := time.Since(start)
-
-					// create new response
-					response := c.newRespFunc(c, took, request, responseHTTP, err)
-
-					// execute OnResponse functions
-					// if any of them returns error, cancel Response
-					for _, f := range c.onResponse {
-						if err := f(i, c, response); err != nil {
-							goto RequestLoop
-						}
-					}
-
-					// increment responses && error count
-					c.Responses().Add(1)
-					if err != nil {
-						c.Errors().Add(1)
-					}
-					c.event(ResponseEvent)
-
-					// send response to Queue
-					c.Response() <- response
 				default:
-					// sleep on default case - otherwise cpu usage can be very high
-					// b-c network is always a bottleneck - this is not an issue
-					// otherwise set it to 0 via Crawler option WithSleep
+					// sleep on Queue errors - otherwise cpu usage can be very high
+					// when Queue keeps failing, set it via Crawler option WithSleep
+					c.Print("queue: ", err)
 					time.Sleep(c.sleep)
 				}
 			}
@@ -155,15 +157,156 @@ func (c *Crawler) Start() {
 	c.event(Started)
 }
 
-// Stop sends signal to notify all goroutines to return.
-func (c *Crawler) Stop() {
-	c.event(Stop)
-	for i := 0; i < c.size; i++ {
-		// non-buffered channel guarantees all goroutines
-		// stopped before event is executed
-		c.stop <- struct{}{}
+// process performs Request received by goroutine i.
+// Panics are recovered and turned into Response with ErrorPanic.
+func (c *Crawler) process(i int, request Request) {
+	var counted, responded bool
+	var responseHTTP *http.Response
+	defer func() {
+		if v := recover(); v != nil {
+			// response is not delivered, so its connection has to be released
+			if responseHTTP != nil && responseHTTP.Body != nil {
+				responseHTTP.Body.Close()
+			}
+			c.recovered(i, request, counted, responded, v)
+		}
+	}()
+
+	// execute OnRequest functions
+	// if any of them returns error, cancel Request
+	// unless it's ErrorFail, then Request fails without being sent
+	var fail *ErrorFail
+	for _, f := range c.onRequest {
+		if err := f(i, c, request); err != nil {
+			if errors.As(err, &fail) {
+				break
+			}
+			c.emit(Payload{Event: DropEvent, Worker: i, Request: request, Error: err})
+			return
+		}
+	}
+
+	// increment requests count
+	c.Requests().Add(1)
+	counted = true
+	c.emit(Payload{Event: RequestEvent, Worker: i, Request: request})
+
+	// perform authenticated http request
+	trace := newTrace(request)
+	start := time.Now()
+	var err error
+	if fail != nil {
+		err = fail.Err
+	} else {
+		responseHTTP, err = c.do(trace, request)
+		responseHTTP, err = c.limitBody(responseHTTP, err)
+	}
+	took := time.Since(start)
+	trace.body(responseHTTP)
+	c.countBody(request, trace, responseHTTP)
+
+	// create new response
+	response := c.newRespFunc(c, took, request, responseHTTP, err)
+	if t, ok := response.(timed); ok {
+		t.setTrace(trace)
+	}
+
+	// execute OnResponse functions
+	// if any of them returns error, cancel Response
+	for _, f := range c.onResponse {
+		if err := f(i, c, response); err != nil {
+			c.emit(Payload{Event: DropEvent, Worker: i, Request: request, Response: response, Error: err})
+			return
+		}
+	}
+
+	// OnResponse functions can fail the Response
+	err = response.Error()
+
+	// increment responses && error count
+	c.Responses().Add(1)
+	if err != nil {
+		class := ResponseErrorClass(response)
+		c.Errors().Add(1)
+		c.ErrorClasses().Counter(class).Add(1)
+		responded = true
+		c.emit(Payload{Event: ErrorEvent, Worker: i, Request: request, Response: response, Error: err, Value: class})
 	}
-	c.event(Stopped)
+	responded = true
+	c.emit(Payload{Event: ResponseEvent, Worker: i, Request: request, Response: response, Error: err})
+
+	// send response to consumers
+	c.send(response)
+}
+
+// send sends Response into Response() channel, unless the Crawler
+// is stopped and nobody receives responses.
+func (c *Crawler) send(response Response) {
+	select {
+	case c.responses <- response:
+		return
+	default:
+	}
+	select {
+	case c.responses <- response:
+	case <-c.ctx.Done():
+	}
+}
+
+// ErrorFail returned by OnRequest function fails Request without sending it.
+// Response with Err goes through OnResponse functions, counters and events
+// the same way as responses of requests that were sent.
+type ErrorFail struct {
+	Err error
+}
+
+func (e *ErrorFail) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ErrorFail) Unwrap() error {
+	return e.Err
+}
+
+// Stop cancels Context of the Crawler to notify all goroutines to return.
+// Only first call stops the Crawler, subsequent calls wait until it's stopped.
+// Requests left in the Queue are not performed, Queue is not closed.
+func (c *Crawler) Stop() {
+	c.stopOnce.Do(func() {
+		c.event(Stop)
+		c.cancel()
+		// guarantees all goroutines stopped before event is executed
+		c.WaitGroup.Wait()
+		c.event(Stopped)
+	})
+}
+
+// ErrorClasses returns counters of response errors by ErrorClass,
+// including errors of reading response bodies, which are not counted in Errors.
+func (c *Crawler) ErrorClasses() *ErrorCounters {
+	return c.classes
+}
+
+// Active returns count of requests being processed by goroutines.
+func (c *Crawler) Active() int {
+	return c.active.Size()
+}
+
+// Deferred returns count of requests waiting to be pushed into the Queue again.
+func (c *Crawler) Deferred() int {
+	return c.deferred.Size()
+}
+
+// Context returns context that is done once Stop was called.
+// It can be used to push requests into the Queue without blocking forever.
+func (c *Crawler) Context() context.Context {
+	return c.ctx
+}
+
+// Response returns channel of performed requests.
+// Responses have to be received, otherwise Crawler blocks.
+func (c *Crawler) Response() chan Response {
+	return c.responses
 }
 
 // Wait waits for all goroutines to finish.
@@ -172,16 +315,79 @@ func (c *Crawler) Wait() {
 	c.WaitGroup.Wait()
 }
 
-// Event registers function f executed on Event e.
+// OnEvent registers function f executed on Event e.
+// Functions are executed by the goroutine that emitted the Event
+// and they can be executed concurrently.
 func (c *Crawler) OnEvent(e Event, f func(e Event, c *Crawler)) {
+	c.Subscribe(e, func(p Payload) {
+		f(p.Event, p.Crawler)
+	})
+}
+
+// Subscribe registers function f executed with Payload of Event e.
+// Functions are executed by the goroutine that emitted the Event
+// and they can be executed concurrently.
+func (c *Crawler) Subscribe(e Event, f func(p Payload)) {
+	c.subscribe(e, f)
+}
+
+// subscriber is a function subscribed to Event, pointer identifies subscription.
+type subscriber struct {
+	f func(p Payload)
+}
+
+func (c *Crawler) subscribe(e Event, f func(p Payload)) *subscriber {
 	defer c.Unlock()
 	c.Lock()
+	s := &subscriber{f: f}
+	c.events[e] = append(c.events[e], s)
+	return s
+}
 
-	if funcs, ok := c.events[e]; ok {
-		c.events[e] = append(funcs, f)
-		return
+// unsubscribe removes subscription, slice is copied
+// because it can be iterated by emitting goroutines.
+func (c *Crawler) unsubscribe(e Event, s *subscriber) {
+	defer c.Unlock()
+	c.Lock()
+	var subscribers []*subscriber
+	for _, v := range c.events[e] {
+		if v != s {
+			subscribers = append(subscribers, v)
+		}
+	}
+	c.events[e] = subscribers
+}
+
+// SubscribeAsync registers function f executed with Payload of Event e
+// in a separate goroutine, one Payload at a time in order they were emitted.
+// Up to size payloads are buffered, once buffer is full emitting goroutine
+// blocks until f finishes. Returned function unsubscribes f.
+func (c *Crawler) SubscribeAsync(e Event, size int, f func(p Payload)) (cancel func()) {
+	var payloads = make(chan Payload, size)
+	var done = make(chan struct{})
+	var once sync.Once
+	go func() {
+		for {
+			select {
+			case p := <-payloads:
+				f(p)
+			case <-done:
+				return
+			}
+		}
+	}()
+	s := c.subscribe(e, func(p Payload) {
+		select {
+		case payloads <- p:
+		case <-done:
+		}
+	})
+	return func() {
+		once.Do(func() {
+			c.unsubscribe(e, s)
+			close(done)
+		})
 	}
-	c.events[e] = []func(Event, *Crawler){f}
 }
 
 // OnRequest registers function f executed when Crawler received Request from Queue.
@@ -192,20 +398,34 @@ func (c *Crawler) OnRequest(f func(i int, c *Crawler, request Request) error) {
 	c.onRequest = append(c.onRequest, f)
 }
 
-// OnResponse registers function f executed before Crawler sends Response to Queue.
-// If this function returns an error then Response is abandoned (not sent to Queue).
+// OnResponse registers function f executed before Crawler sends Response to Response() channel.
+// If this function returns an error then Response is abandoned (not sent to the channel).
 func (c *Crawler) OnResponse(f func(i int, c *Crawler, response Response) error) {
 	defer c.Unlock()
 	c.Lock()
 	c.onResponse = append(c.onResponse, f)
 }
 
+// event emits Event not related to any worker.
 func (c *Crawler) event(e Event) {
-	defer c.Unlock()
+	c.emit(Payload{Event: e, Worker: -1})
+}
+
+// emit executes functions registered for Payload Event.
+// Lock is held only to copy registered functions, so functions
+// can emit events and register new ones.
+func (c *Crawler) emit(p Payload) {
 	c.Lock()
-	if funcs, ok := c.events[e]; ok {
-		for _, f := range funcs {
-			f(e, c)
-		}
+	subscribers := c.events[p.Event]
+	c.Unlock()
+	if len(subscribers) == 0 {
+		return
+	}
+	p.Crawler = c
+	if p.Time.IsZero() {
+		p.Time = time.Now()
+	}
+	for _, s := range subscribers {
+		s.f(p)
 	}
 }
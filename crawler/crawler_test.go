@@ -18,6 +18,7 @@ package crawler_test
 import (
 	"bufio"
 	"bytes"
+	"context"
 	. "github.com/bukowa/micro/crawler"
 	"io"
 	"net/http"
@@ -54,7 +55,7 @@ func TestCrawler(t *testing.T) {
 				if err != nil {
 					t.Error(err)
 				}
-				c.Request() <- r
+				c.Push(context.Background(), r)
 				requestCounter.Add(1)
 			}
 		}
@@ -108,7 +109,7 @@ func TestCrawlerWithDefaultLog(t *testing.T) {
 	req, _ := NewRequest("GET", "invalid", nil)
 
 	crawler.Start()
-	crawler.Request() <- req
+	crawler.Push(context.Background(), req)
 	<- crawler.Response()
 	crawler.Stop()
 	crawler.Wait()
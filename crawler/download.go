@@ -0,0 +1,472 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrorDownloadInProgress is returned when the same Request is already downloaded by other goroutine.
+var ErrorDownloadInProgress = errors.New("download already in progress")
+
+// ErrorChecksum is returned when checksum of downloaded file does not match expected one.
+type ErrorChecksum struct {
+	Want string
+	Got  string
+}
+
+func (e ErrorChecksum) Error() string {
+	return fmt.Sprintf("checksum mismatch: want %s, got %s", e.Want, e.Got)
+}
+
+// ErrorContentRange is returned when Content-Range of the response
+// does not continue partial file of the given size.
+type ErrorContentRange struct {
+	Range string
+	Size  int64
+}
+
+func (e ErrorContentRange) Error() string {
+	return fmt.Sprintf("content range %q does not continue partial file of size %d", e.Range, e.Size)
+}
+
+// ResponsePath returns path of the file Response body was stored in.
+// Responses that do not implement Path() or were not downloaded have empty path.
+func ResponsePath(r Response) string {
+	if p, ok := r.(interface{ Path() string }); ok {
+		return p.Path()
+	}
+	return ""
+}
+
+// stored is implemented by responses that can hold path of the downloaded file.
+type stored interface {
+	setPath(path string)
+}
+
+// failed is implemented by responses that can hold error of the Downloader.
+type failed interface {
+	setError(err error)
+}
+
+// Downloader streams response bodies into files.
+// Files are named by SHA-256 of their content, so identical files are stored once.
+// Partially downloaded files are kept and resumed with Range request
+// next time the same Request is crawled. Range is conditional on If-Range
+// validator of the partial file, so file that changed is downloaded again.
+// Partial files without strong ETag or Last-Modified are not resumed.
+// Partial responses that do not continue the partial file are downloaded again.
+type Downloader struct {
+	sync.Mutex
+
+	dir      string
+	checksum func(r Request) string
+	progress int64
+	retries  int
+
+	// active are requests being downloaded by their key
+	active   map[string]*http.Request
+	attempts map[string]int
+}
+
+type DownloaderOption = func(d *Downloader)
+
+// WithChecksum sets function returning expected SHA-256 hex checksum of the Request body.
+// Empty checksum is not verified.
+var WithChecksum = func(f func(r Request) string) DownloaderOption {
+	return func(d *Downloader) {
+		d.checksum = f
+	}
+}
+
+// WithProgress emits DownloadProgress each time n bytes were downloaded.
+var WithProgress = func(n int64) DownloaderOption {
+	return func(d *Downloader) {
+		d.progress = n
+	}
+}
+
+// WithRetries sets how many times interrupted download is sent back into the Queue.
+// Downloads that do not fit into the full Queue are not retried.
+var WithRetries = func(n int) DownloaderOption {
+	return func(d *Downloader) {
+		d.retries = n
+	}
+}
+
+// NewDownloader creates new Downloader storing files in dir.
+func NewDownloader(dir string, opts ...DownloaderOption) *Downloader {
+	d := &Downloader{
+		dir:      dir,
+		retries:  3,
+		active:   map[string]*http.Request{},
+		attempts: map[string]int{},
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// WithDownloader streams successful response bodies into files.
+// Body of the Response sent to Response() channel is replaced with stored file.
+// Responses of interrupted downloads are abandoned and their requests are retried.
+// Responses of files that cannot be stored, for example because of checksum
+// mismatch or too large body, fail with the error and have empty body.
+var WithDownloader = func(d *Downloader) Option {
+	return func(c *Crawler) {
+		c.OnRequest(func(i int, c *Crawler, r Request) error {
+			return d.start(c, r)
+		})
+		c.OnResponse(func(i int, c *Crawler, r Response) error {
+			return d.download(i, c, r)
+		})
+		// requests dropped by other functions or that panicked are no longer active
+		var inactive = func(p Payload) {
+			if !errors.Is(p.Error, ErrorDownloadInProgress) {
+				d.done(c.RequestKey(p.Request), p.Request.Request(), false)
+			}
+		}
+		c.Subscribe(DropEvent, inactive)
+		c.Subscribe(PanicEvent, inactive)
+	}
+}
+
+// Path returns path of the file stored with given checksum.
+func (d *Downloader) Path(checksum string) string {
+	return filepath.Join(d.dir, checksum[:2], checksum)
+}
+
+func (d *Downloader) partial(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, "partial", hex.EncodeToString(sum[:]))
+}
+
+// validator returns path of the file with If-Range validator of the partial file.
+func validator(partial string) string {
+	return partial + ".validator"
+}
+
+// start marks Request as active and requests only missing part of the file,
+// if partial file has a validator.
+func (d *Downloader) start(c *Crawler, r Request) error {
+	key := c.RequestKey(r)
+	d.Lock()
+	if _, ok := d.active[key]; ok {
+		d.Unlock()
+		return ErrorDownloadInProgress
+	}
+	d.active[key] = r.Request()
+	d.Unlock()
+
+	header := r.Request().Header
+	header.Del("Range")
+	header.Del("If-Range")
+	partial := d.partial(key)
+	info, err := os.Stat(partial)
+	if err != nil || info.Size() == 0 {
+		return nil
+	}
+	if v, err := ioutil.ReadFile(validator(partial)); err == nil && len(v) > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", info.Size()))
+		header.Set("If-Range", string(v))
+	}
+	return nil
+}
+
+// done marks Request as inactive, if it's the one being downloaded.
+func (d *Downloader) done(key string, req *http.Request, success bool) {
+	defer d.Unlock()
+	d.Lock()
+	if d.active[key] != req {
+		return
+	}
+	delete(d.active, key)
+	if success {
+		delete(d.attempts, key)
+	}
+}
+
+func (d *Downloader) download(i int, c *Crawler, r Response) (err error) {
+	key := c.RequestKey(r)
+	res := r.Response()
+	if r.Error() != nil || res == nil {
+		d.done(key, r.Request(), false)
+		return nil
+	}
+	defer func() {
+		d.done(key, r.Request(), err == nil)
+	}()
+
+	partial := d.partial(key)
+	var size int64
+	if info, err := os.Stat(partial); err == nil {
+		size = info.Size()
+	}
+	flag := os.O_CREATE | os.O_WRONLY
+	switch res.StatusCode {
+	case http.StatusOK:
+		flag |= os.O_TRUNC
+	case http.StatusPartialContent:
+		// part of the file after the range start is downloaded again
+		v := res.Header.Get("Content-Range")
+		start, _, ok := contentRange(v)
+		if !ok || start > size {
+			res.Body.Close()
+			return d.restart(i, c, r, key, ErrorContentRange{Range: v, Size: size})
+		}
+		if start < size {
+			if err := os.Truncate(partial, start); err != nil {
+				res.Body.Close()
+				return fail(r, err)
+			}
+		}
+		flag |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		res.Body.Close()
+		// partial file is already complete only if it has size of the file
+		v := res.Header.Get("Content-Range")
+		if _, total, ok := contentRange(v); !ok || total != size {
+			return d.restart(i, c, r, key, ErrorContentRange{Range: v, Size: size})
+		}
+		return fail(r, d.store(r, partial))
+	default:
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(partial), 0755); err != nil {
+		res.Body.Close()
+		return fail(r, err)
+	}
+	if res.StatusCode == http.StatusOK {
+		if err := writeValidator(partial, res.Header); err != nil {
+			res.Body.Close()
+			return fail(r, err)
+		}
+	}
+	f, err := os.OpenFile(partial, flag, 0644)
+	if err != nil {
+		res.Body.Close()
+		return fail(r, err)
+	}
+	w := &progressWriter{Writer: f, crawler: c, worker: i, response: r, every: d.progress}
+	if info, err := f.Stat(); err == nil {
+		w.written = info.Size()
+	}
+	_, err = io.Copy(w, res.Body)
+	res.Body.Close()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if IsBodyTooLarge(err) {
+		// body would be too large again
+		os.Remove(partial)
+		os.Remove(validator(partial))
+		return fail(r, err)
+	}
+	if err != nil {
+		d.retry(i, c, r, key, err)
+		return err
+	}
+	w.emit()
+	return fail(r, d.store(r, partial))
+}
+
+// restart removes partial file, so Request is downloaded again from the start.
+func (d *Downloader) restart(i int, c *Crawler, r Response, key string, err error) error {
+	partial := d.partial(key)
+	os.Remove(partial)
+	os.Remove(validator(partial))
+	d.retry(i, c, r, key, err)
+	return err
+}
+
+// fail sets err as the error of the Response and replaces its body with empty one.
+// Error is returned if Response cannot hold it, so Response is abandoned.
+func fail(r Response, err error) error {
+	if err == nil {
+		return nil
+	}
+	f, ok := r.(failed)
+	if !ok {
+		return err
+	}
+	f.setError(err)
+	r.Response().Body = http.NoBody
+	return nil
+}
+
+// contentRange parses Content-Range header, start is -1 for unsatisfied range
+// and total is -1 if it's unknown.
+func contentRange(v string) (start, total int64, ok bool) {
+	if !strings.HasPrefix(v, "bytes ") {
+		return 0, 0, false
+	}
+	v = strings.TrimSpace(v[len("bytes "):])
+	i := strings.IndexByte(v, '/')
+	if i < 0 {
+		return 0, 0, false
+	}
+	total = -1
+	if v[i+1:] != "*" {
+		var err error
+		if total, err = strconv.ParseInt(v[i+1:], 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	if v[:i] == "*" {
+		return -1, total, true
+	}
+	j := strings.IndexByte(v[:i], '-')
+	if j < 0 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(v[:j], 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	return start, total, true
+}
+
+// writeValidator stores strong ETag or Last-Modified of the response,
+// so download is resumed only when the file did not change.
+func writeValidator(partial string, header http.Header) error {
+	v := header.Get("ETag")
+	if strings.HasPrefix(v, "W/") {
+		v = ""
+	}
+	if v == "" {
+		v = header.Get("Last-Modified")
+	}
+	if v == "" {
+		err := os.Remove(validator(partial))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return ioutil.WriteFile(validator(partial), []byte(v), 0644)
+}
+
+// store moves complete partial file to its content addressed path.
+func (d *Downloader) store(r Response, partial string) error {
+	os.Remove(validator(partial))
+	checksum, err := sum(partial)
+	if err != nil {
+		return err
+	}
+	if d.checksum != nil {
+		if want := d.checksum(r); want != "" && want != checksum {
+			os.Remove(partial)
+			return ErrorChecksum{Want: want, Got: checksum}
+		}
+	}
+	path := d.Path(checksum)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		os.Remove(partial)
+	} else if err := os.Rename(partial, path); err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	r.Response().Body = f
+	if s, ok := r.(stored); ok {
+		s.setPath(path)
+	}
+	return nil
+}
+
+// retry sends Request of interrupted download back into the Queue.
+func (d *Downloader) retry(i int, c *Crawler, r Response, key string, err error) {
+	d.Lock()
+	d.attempts[key]++
+	retry := d.attempts[key] <= d.retries
+	d.Unlock()
+	if !retry {
+		return
+	}
+	// request has to be inactive before it's sent back
+	d.done(key, r.Request(), false)
+	req := r.Request().Clone(r.Request().Context())
+	var request Request = &retried{BaseRequest{request: req, depth: RequestDepth(r)}}
+	c.emit(Payload{Event: RetryEvent, Worker: i, Request: request, Response: r, Error: err})
+	// workers must not block on full Queue
+	if err := c.TryPush(request); err != nil {
+		c.Print("retry of ", req.URL, " failed: ", err)
+	}
+}
+
+func sum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// progressWriter emits DownloadProgress every n bytes written.
+type progressWriter struct {
+	io.Writer
+	crawler  *Crawler
+	worker   int
+	response Response
+	every    int64
+	written  int64
+	emitted  int64
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.written += int64(n)
+	if w.every > 0 && w.written-w.emitted >= w.every {
+		w.emit()
+	}
+	return n, err
+}
+
+func (w *progressWriter) emit() {
+	if w.every <= 0 || w.emitted == w.written {
+		return
+	}
+	w.emitted = w.written
+	w.crawler.emit(Payload{
+		Event:    DownloadProgress,
+		Worker:   w.worker,
+		Response: w.response,
+		Value:    w.written,
+	})
+}
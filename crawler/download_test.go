@@ -0,0 +1,238 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestDownloader(t *testing.T) {
+	var content = bytes.Repeat([]byte("0123456789"), 10000)
+	var checksum = sha256.Sum256(content)
+	var want = hex.EncodeToString(checksum[:])
+
+	var mu sync.Mutex
+	var interrupted = map[string]bool{}
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range")+" "+r.Header.Get("If-Range"))
+		interrupt := (r.URL.Path == "/interrupt" || r.URL.Path == "/changed") && !interrupted[r.URL.Path]
+		interrupted[r.URL.Path] = interrupted[r.URL.Path] || interrupt
+		mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		if interrupt {
+			// send half of the body and close connection
+			body := content
+			if r.URL.Path == "/changed" {
+				// file changes after it was interrupted
+				w.Header().Set("ETag", `"v0"`)
+				body = bytes.Repeat([]byte("x"), len(content))
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Write(body[:len(body)/2])
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	downloader := NewDownloader(dir,
+		WithProgress(1000),
+		WithChecksum(func(r Request) string {
+			if r.Request().URL.Path == "/invalid" {
+				return "invalid"
+			}
+			return ""
+		}),
+	)
+	c := NewCrawler(1, WithDownloader(downloader), WithLoggerOutput(ioutil.Discard))
+	var progress, retries = NewCounter(), NewCounter()
+	c.Subscribe(DownloadProgress, func(p Payload) {
+		progress.Add(1)
+	})
+	c.Subscribe(RetryEvent, func(p Payload) {
+		retries.Add(1)
+	})
+	c.Start()
+	defer c.Wait()
+	defer c.Stop()
+
+	// later function drops the request, so it's not active
+	var dropped bool
+	c.OnRequest(func(i int, c *Crawler, r Request) error {
+		if r.Request().URL.Path == "/copy" && !dropped {
+			dropped = true
+			return errors.New("dropped")
+		}
+		return nil
+	})
+	r, _ := NewRequest("GET", ts.URL+"/copy", nil)
+	c.Push(context.Background(), r)
+
+	for _, path := range []string{"/interrupt", "/copy", "/changed"} {
+		r, _ := NewRequest("GET", ts.URL+path, nil)
+		c.Push(context.Background(), r)
+		res := <-c.Response()
+		if ResponsePath(res) != downloader.Path(want) {
+			t.Errorf("invalid path: %s", ResponsePath(res))
+		}
+		b, err := ioutil.ReadAll(res.Response().Body)
+		res.Response().Body.Close()
+		if err != nil || !bytes.Equal(b, content) {
+			t.Errorf("invalid body: %v", err)
+		}
+	}
+	stored, err := ioutil.ReadFile(downloader.Path(want))
+	if err != nil || !bytes.Equal(stored, content) {
+		t.Errorf("invalid file: %v", err)
+	}
+	if retries.Size() != 2 || progress.Size() < 5 {
+		t.Errorf("invalid events: retries: %v progress: %v", retries.Size(), progress.Size())
+	}
+	// interrupted downloads were resumed with conditional Range requests,
+	// changed file was downloaded again
+	resume := "bytes=" + strconv.Itoa(len(content)/2) + "-"
+	wantRanges := []string{" ", resume + ` "v1"`, " ", " ", resume + ` "v0"`}
+	if fmt.Sprint(ranges) != fmt.Sprint(wantRanges) {
+		t.Errorf("want ranges %q, got: %q", wantRanges, ranges)
+	}
+
+	// checksum mismatch fails the Response
+	r, _ = NewRequest("GET", ts.URL+"/invalid", nil)
+	c.Push(context.Background(), r)
+	if res := <-c.Response(); res.Error() != (ErrorChecksum{Want: "invalid", Got: want}) || res.Response().Body != http.NoBody {
+		t.Errorf("want ErrorChecksum, got: %v", res.Error())
+	}
+}
+
+func TestDownloaderContentRange(t *testing.T) {
+	var content = bytes.Repeat([]byte("0123456789"), 1000)
+	var checksum = sha256.Sum256(content)
+	var want = hex.EncodeToString(checksum[:])
+
+	var mu sync.Mutex
+	var requests = map[string]int{}
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		ranges = append(ranges, r.URL.Path+" "+r.Header.Get("Range"))
+		mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		switch {
+		case r.URL.Path == "/large":
+			// body without Content-Length is limited while it's read
+			w.Write(content)
+			w.(http.Flusher).Flush()
+			w.Write(content)
+		case n == 1:
+			// send half of the body and close connection
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:len(content)/2])
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		case n == 2 && r.URL.Path == "/overlap":
+			// range starts before the end of partial file
+			start := len(content)/2 - 10
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[start:])
+		case n == 2 && r.URL.Path == "/gap":
+			// range starts after the end of partial file
+			start := len(content)/2 + 10
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[start:])
+		case n == 2 && r.URL.Path == "/unsatisfiable":
+			// partial file is not the complete file
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(content)))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		default:
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	downloader := NewDownloader(dir)
+	c := NewCrawler(1, WithDownloader(downloader), WithMaxBodySize(int64(len(content))), WithLoggerOutput(ioutil.Discard))
+	c.Start()
+	defer c.Wait()
+	defer c.Stop()
+
+	for _, path := range []string{"/overlap", "/gap", "/unsatisfiable"} {
+		r, _ := NewRequest("GET", ts.URL+path, nil)
+		c.Push(context.Background(), r)
+		res := <-c.Response()
+		b, err := ioutil.ReadAll(res.Response().Body)
+		res.Response().Body.Close()
+		if res.Error() != nil || err != nil || !bytes.Equal(b, content) || ResponsePath(res) != downloader.Path(want) {
+			t.Errorf("%s: invalid download: %v %v", path, res.Error(), err)
+		}
+	}
+	// partial files that cannot be continued are downloaded again
+	resume := "bytes=" + strconv.Itoa(len(content)/2) + "-"
+	wantRanges := []string{
+		"/overlap ", "/overlap " + resume,
+		"/gap ", "/gap " + resume, "/gap ",
+		"/unsatisfiable ", "/unsatisfiable " + resume, "/unsatisfiable ",
+	}
+	if fmt.Sprint(ranges) != fmt.Sprint(wantRanges) {
+		t.Errorf("want ranges %q, got: %q", wantRanges, ranges)
+	}
+
+	// too large body is not downloaded again
+	r, _ := NewRequest("GET", ts.URL+"/large", nil)
+	c.Push(context.Background(), r)
+	if res := <-c.Response(); !IsBodyTooLarge(res.Error()) {
+		t.Errorf("want ErrorBodyTooLarge, got: %v", res.Error())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests["/large"] != 1 {
+		t.Errorf("too large body downloaded %d times", requests["/large"])
+	}
+}
@@ -15,6 +15,8 @@ limitations under the License.
 */
 package crawler
 
+import "time"
+
 // Event represents something that can happen.
 type Event string
 
@@ -32,6 +34,45 @@ const (
 
 	// RequestEvent happens after Crawler received a Request from the Queue.
 	RequestEvent Event = "request"
-	// ResponseEvent happens just before Crawler sends Response to the Queue.
+	// ResponseEvent happens just before Crawler sends Response to Response() channel.
 	ResponseEvent Event = "response"
+	// ErrorEvent happens when Request failed, just before ResponseEvent, and when
+	// reading body of the Response failed, then Worker is -1 and Response is nil.
+	// Value is ErrorClass of the error.
+	ErrorEvent Event = "error"
+	// DropEvent happens when OnRequest or OnResponse function abandoned Request or Response.
+	DropEvent Event = "drop"
+	// RetryEvent happens when Request is scheduled to be sent into the Queue again.
+	RetryEvent Event = "retry"
+	// DownloadProgress happens when Downloader wrote next part of the file, Value is a number of bytes written.
+	DownloadProgress Event = "download_progress"
+	// PanicEvent happens when Crawler recovered a panic while processing Request.
+	PanicEvent Event = "panic"
+
+	// BudgetExhausted happens when one of the crawl budgets is exhausted, just before Crawler is stopped.
+	BudgetExhausted Event = "budget_exhausted"
+
+	// BreakerOpened happens when Breaker opens circuit of a host.
+	BreakerOpened Event = "breaker_opened"
+	// BreakerHalfOpened happens when Breaker lets probe request through to a host with open circuit.
+	BreakerHalfOpened Event = "breaker_half_opened"
+	// BreakerClosed happens when probe request succeeded and Breaker closed circuit of a host.
+	BreakerClosed Event = "breaker_closed"
 )
+
+// Payload describes Event occurrence.
+// Fields that are not related to the Event are zero valued.
+type Payload struct {
+	Event   Event
+	Crawler *Crawler
+	Time    time.Time
+	// Worker is an index of the crawling goroutine or -1
+	// when Event was not emitted by any of them.
+	Worker   int
+	Request  Request
+	Response Response
+	Error    error
+	// Value is an additional Event data, for example
+	// Budget for BudgetExhausted or host for Breaker events.
+	Value interface{}
+}
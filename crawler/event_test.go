@@ -0,0 +1,123 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestPayload(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var errDrop = errors.New("drop")
+	var payloads = make(chan Payload, 10)
+	var send = func(p Payload) {
+		payloads <- p
+	}
+
+	c := NewCrawler(1, WithLoggerOutput(ioutil.Discard))
+	c.OnRequest(func(i int, c *Crawler, r Request) error {
+		if r.Request().URL.Path == "/drop" {
+			return errDrop
+		}
+		return nil
+	})
+	c.Subscribe(RequestEvent, send)
+	c.Subscribe(ErrorEvent, send)
+	c.Subscribe(DropEvent, send)
+	c.Start()
+
+	ok, _ := NewRequest("GET", ts.URL, nil)
+	c.Push(context.Background(), ok)
+	<-c.Response()
+	if p := <-payloads; p.Event != RequestEvent || p.Request != ok || p.Worker != 0 || p.Crawler != c || p.Time.IsZero() {
+		t.Errorf("invalid payload: %+v", p)
+	}
+
+	drop, _ := NewRequest("GET", ts.URL+"/drop", nil)
+	c.Push(context.Background(), drop)
+	if p := <-payloads; p.Event != DropEvent || p.Request != drop || p.Error != errDrop {
+		t.Errorf("invalid payload: %+v", p)
+	}
+
+	invalid, _ := NewRequest("GET", "invalid", nil)
+	c.Push(context.Background(), invalid)
+	<-c.Response()
+	<-payloads
+	if p := <-payloads; p.Event != ErrorEvent || p.Error == nil || p.Response == nil || p.Response.Error() != p.Error {
+		t.Errorf("invalid payload: %+v", p)
+	}
+	c.Stop()
+	c.Wait()
+}
+
+func TestSubscribeAsync(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var release = make(chan struct{})
+	var received = make(chan Payload, 10)
+	c := NewCrawler(1, WithLoggerOutput(ioutil.Discard))
+	cancel := c.SubscribeAsync(ResponseEvent, 5, func(p Payload) {
+		<-release
+		received <- p
+	})
+	defer cancel()
+	// registering from inside of the callback does not deadlock
+	c.OnEvent(Started, func(e Event, c *Crawler) {
+		c.OnEvent(Stopped, func(e Event, c *Crawler) {})
+	})
+	c.Start()
+
+	// blocked subscriber does not block the crawler
+	for i := 0; i < 3; i++ {
+		r, _ := NewRequest("GET", ts.URL, nil)
+		c.Push(context.Background(), r)
+		select {
+		case <-c.Response():
+		case <-time.After(time.Second):
+			t.Fatal("crawler blocked by async subscriber")
+		}
+	}
+	close(release)
+	for i := 0; i < 3; i++ {
+		if p := <-received; p.Event != ResponseEvent || p.Response == nil {
+			t.Errorf("invalid payload: %+v", p)
+		}
+	}
+
+	// canceled subscriber is not called
+	cancel()
+	r, _ := NewRequest("GET", ts.URL, nil)
+	c.Push(context.Background(), r)
+	<-c.Response()
+	select {
+	case p := <-received:
+		t.Errorf("canceled subscriber called: %+v", p)
+	case <-time.After(time.Millisecond * 50):
+	}
+	c.Stop()
+	c.Wait()
+}
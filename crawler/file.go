@@ -0,0 +1,214 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileTransport is a http.RoundTripper serving file:// urls from local filesystem,
+// so local mirrors can be crawled the same way as websites.
+// Content type of files is guessed from extension or sniffed from content.
+// Directories are served as their index file or html listing of their entries.
+type FileTransport struct {
+	root  string
+	index string
+}
+
+// NewFileTransport creates new FileTransport.
+// If root is not empty, paths of urls are relative to root and cannot leave it,
+// otherwise paths are absolute paths of the filesystem.
+func NewFileTransport(root string) *FileTransport {
+	return &FileTransport{root: root, index: "index.html"}
+}
+
+// WithFileTransport crawls file:// urls with FileTransport, other urls are sent by the client transport.
+var WithFileTransport = func(root string) Option {
+	return func(c *Crawler) {
+		next := c.client.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		client := *c.client
+		client.Transport = &fileRouter{file: NewFileTransport(root), next: next}
+		c.client = &client
+	}
+}
+
+// fileRouter sends file:// requests to FileTransport.
+type fileRouter struct {
+	file *FileTransport
+	next http.RoundTripper
+}
+
+func (r *fileRouter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "file" {
+		return r.file.RoundTrip(req)
+	}
+	return r.next.RoundTrip(req)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *FileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if req.URL.Scheme != "file" {
+		return nil, fmt.Errorf("unsupported protocol scheme %q", req.URL.Scheme)
+	}
+	if host := req.URL.Host; host != "" && host != "localhost" {
+		return nil, fmt.Errorf("unsupported file host %q", host)
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.response(req, http.StatusMethodNotAllowed, nil, nil), nil
+	}
+
+	name := t.path(req.URL.Path)
+	info, err := os.Stat(name)
+	switch {
+	case os.IsNotExist(err):
+		return t.response(req, http.StatusNotFound, nil, nil), nil
+	case os.IsPermission(err):
+		return t.response(req, http.StatusForbidden, nil, nil), nil
+	case err != nil:
+		return nil, err
+	}
+
+	if info.IsDir() {
+		// relative links of the directory work only with trailing slash
+		if !strings.HasSuffix(req.URL.Path, "/") {
+			u := *req.URL
+			u.Path += "/"
+			u.RawPath = ""
+			header := http.Header{"Location": {u.String()}}
+			return t.response(req, http.StatusMovedPermanently, header, nil), nil
+		}
+		index := filepath.Join(name, t.index)
+		if i, err := os.Stat(index); err == nil && !i.IsDir() {
+			return t.file(req, index, i)
+		}
+		return t.listing(req, name)
+	}
+	return t.file(req, name, info)
+}
+
+// path returns filesystem path of the url path.
+func (t *FileTransport) path(p string) string {
+	if t.root == "" {
+		return filepath.FromSlash(p)
+	}
+	return filepath.Join(t.root, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+func (t *FileTransport) file(req *http.Request, name string, info os.FileInfo) (*http.Response, error) {
+	f, err := os.Open(name)
+	if os.IsPermission(err) {
+		return t.response(req, http.StatusForbidden, nil, nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		var buf [512]byte
+		n, _ := io.ReadFull(f, buf[:])
+		contentType = http.DetectContentType(buf[:n])
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	header := http.Header{
+		"Content-Type":  {contentType},
+		"Last-Modified": {info.ModTime().UTC().Format(http.TimeFormat)},
+	}
+	res := t.response(req, http.StatusOK, header, f)
+	res.ContentLength = info.Size()
+	return res, nil
+}
+
+func (t *FileTransport) listing(req *http.Request, name string) (*http.Response, error) {
+	infos, err := ioutil.ReadDir(name)
+	if os.IsPermission(err) {
+		return t.response(req, http.StatusForbidden, nil, nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	var b bytes.Buffer
+	title := html.EscapeString(req.URL.Path)
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head><title>Index of %s</title></head>\n<body>\n<h1>Index of %s</h1>\n<ul>\n", title, title)
+	for _, info := range infos {
+		entry := info.Name()
+		if info.IsDir() {
+			entry += "/"
+		}
+		href := (&url.URL{Path: entry}).String()
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(entry))
+	}
+	b.WriteString("</ul>\n</body>\n</html>\n")
+
+	header := http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+	res := t.response(req, http.StatusOK, header, ioutil.NopCloser(&b))
+	res.ContentLength = int64(b.Len())
+	return res, nil
+}
+
+// response creates synthetic http.Response, nil body is replaced with status text.
+// Body of HEAD requests is discarded.
+func (t *FileTransport) response(req *http.Request, status int, header http.Header, body io.ReadCloser) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	var length int64 = -1
+	if body == nil {
+		text := http.StatusText(status)
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		body, length = ioutil.NopCloser(strings.NewReader(text)), int64(len(text))
+	}
+	res := &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		Header:        header,
+		Body:          body,
+		ContentLength: length,
+		Request:       req,
+	}
+	if req.Method == http.MethodHead {
+		body.Close()
+		res.Body = http.NoBody
+	}
+	return res
+}
@@ -0,0 +1,149 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func testFiles(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "crawler-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"page.html":       `<a href="docs/">docs</a>`,
+		"data":            `%PDF-1.4 document`,
+		"docs/a b.txt":    "text",
+		"docs/sub/x.json": `{}`,
+		"site/index.html": "<h1>index</h1>",
+		"site/other.html": "other",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFileTransport(t *testing.T) {
+	dir := testFiles(t)
+	defer os.RemoveAll(dir)
+	client := &http.Client{Transport: NewFileTransport(dir)}
+
+	tests := []struct {
+		method      string
+		url         string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"GET", "file:///page.html", 200, "text/html; charset=utf-8", `<a href="docs/">docs</a>`},
+		{"GET", "file:///data", 200, "application/pdf", "%PDF-1.4 document"},
+		{"GET", "file://localhost/docs/a%20b.txt", 200, "text/plain; charset=utf-8", "text"},
+		{"HEAD", "file:///page.html", 200, "text/html; charset=utf-8", ""},
+		{"GET", "file:///missing", 404, "text/plain; charset=utf-8", "Not Found"},
+		{"POST", "file:///page.html", 405, "text/plain; charset=utf-8", "Method Not Allowed"},
+		// directory without slash is redirected
+		{"GET", "file:///site", 200, "text/html; charset=utf-8", "<h1>index</h1>"},
+		// paths cannot leave root
+		{"GET", "file:///../../page.html", 200, "text/html; charset=utf-8", `<a href="docs/">docs</a>`},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.url, nil)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != tt.status || res.Header.Get("Content-Type") != tt.contentType || string(body) != tt.body {
+			t.Errorf("%s %s: got %d %s %q", tt.method, tt.url, res.StatusCode, res.Header.Get("Content-Type"), body)
+		}
+	}
+
+	res, err := client.Get("file:///docs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	for _, want := range []string{"<title>Index of /docs/</title>", `<a href="a%20b.txt">a b.txt</a>`, `<a href="sub/">sub/</a>`} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("listing does not contain %s: %s", want, body)
+		}
+	}
+
+	if _, err := client.Get("file://remote/page.html"); err == nil {
+		t.Error("remote host accepted")
+	}
+}
+
+func TestWithFileTransport(t *testing.T) {
+	dir := testFiles(t)
+	defer os.RemoveAll(dir)
+
+	c := NewCrawler(2, WithFileTransport(dir), WithSeen(NewSeen()))
+	c.Start()
+	defer c.Stop()
+
+	var crawled []string
+	r, _ := NewRequest("GET", "file:///docs/", nil)
+	c.Push(context.Background(), r)
+	pending := 1
+	for pending > 0 {
+		select {
+		case res := <-c.Response():
+			pending--
+			if res.Error() != nil {
+				t.Fatal(res.Error())
+			}
+			crawled = append(crawled, res.Request().URL.Path)
+			body, _ := ioutil.ReadAll(res.Response().Body)
+			res.Response().Body.Close()
+			if !strings.HasPrefix(res.Response().Header.Get("Content-Type"), "text/html") {
+				continue
+			}
+			// follow links of the listing
+			for _, part := range strings.Split(string(body), `href="`)[1:] {
+				link, _ := res.Request().URL.Parse(part[:strings.IndexByte(part, '"')])
+				child, _ := NewChildRequest(res, "GET", link.String(), nil)
+				c.Push(context.Background(), child)
+				pending++
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("timeout")
+		}
+	}
+	sort.Strings(crawled)
+	if strings.Join(crawled, " ") != "/docs/ /docs/a b.txt /docs/sub/ /docs/sub/x.json" {
+		t.Errorf("invalid crawled paths: %v", crawled)
+	}
+}
@@ -0,0 +1,244 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrorTemplate is returned when template cannot be parsed.
+type ErrorTemplate string
+
+func (e ErrorTemplate) Error() string {
+	return fmt.Sprintf("invalid template: %s", string(e))
+}
+
+var (
+	templateRange = regexp.MustCompile(`^(-?\d+)\.\.(-?\d+)(?:\.\.(\d+))?$`)
+	templateList  = regexp.MustCompile(`^[^{}"'\s:]*,[^{}"'\s:]*$`)
+	templateGroup = regexp.MustCompile(`\{[^{}]*\}`)
+)
+
+// Generator expands templates of url, header values and body into requests.
+// Each group in braces is expanded:
+//
+//	{1..5}     numbers from 1 to 5
+//	{0..10..5} numbers from 0 to 10 with step 5
+//	{01..10}   zero padded numbers
+//	{a,b,c}    list of values, values cannot contain quotes, colons or spaces
+//
+// Other groups, for example json objects, are left as they are.
+// Requests are all combinations of expanded values, they and values of ranges
+// are created lazily, so Generator can describe millions of requests.
+type Generator struct {
+	method string
+	url    template
+	header map[string][]template
+	body   template
+	values []group
+	n      int
+}
+
+// maxInt is the largest int, number of requests of Generator cannot exceed it.
+const maxInt = int(^uint(0) >> 1)
+
+// group are values of a single group in braces.
+// Values of ranges are formatted when they are needed.
+type group struct {
+	// list are values of a list, nil for ranges
+	list  []string
+	from  int
+	step  int
+	width int
+	n     int
+}
+
+func (g group) len() int {
+	if g.list != nil {
+		return len(g.list)
+	}
+	return g.n
+}
+
+func (g group) value(i int) string {
+	if g.list != nil {
+		return g.list[i]
+	}
+	return fmt.Sprintf("%0*d", g.width, g.from+i*g.step)
+}
+
+// template is a text split into literal parts and indexes of Generator values between them.
+type template struct {
+	parts  []string
+	values []int
+}
+
+// NewGenerator creates new Generator.
+func NewGenerator(method, url string, header http.Header, body string) (*Generator, error) {
+	g := &Generator{method: method, header: map[string][]template{}}
+	var err error
+	if g.url, err = g.parse(url); err != nil {
+		return nil, err
+	}
+	for k, vv := range header {
+		for _, v := range vv {
+			t, err := g.parse(v)
+			if err != nil {
+				return nil, err
+			}
+			g.header[k] = append(g.header[k], t)
+		}
+	}
+	if g.body, err = g.parse(body); err != nil {
+		return nil, err
+	}
+	g.n = 1
+	for _, v := range g.values {
+		if v.len() > maxInt/g.n {
+			return nil, ErrorTemplate("too many requests")
+		}
+		g.n *= v.len()
+	}
+	return g, nil
+}
+
+// Len returns number of requests described by Generator.
+// NewGenerator returns error when it does not fit in int.
+func (g *Generator) Len() int {
+	return g.n
+}
+
+// Request returns n-th Request, last group changes fastest.
+func (g *Generator) Request(n int) (Request, error) {
+	if n < 0 || n >= g.Len() {
+		return nil, ErrorTemplate(fmt.Sprintf("request %d out of range", n))
+	}
+	var index = make([]int, len(g.values))
+	for i := len(g.values) - 1; i >= 0; i-- {
+		index[i] = n % g.values[i].len()
+		n /= g.values[i].len()
+	}
+	var body = g.expand(g.body, index)
+	req, err := http.NewRequest(g.method, g.expand(g.url, index), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == "" {
+		req.Body, req.GetBody, req.ContentLength = http.NoBody, nil, 0
+	}
+	for k, templates := range g.header {
+		for _, t := range templates {
+			req.Header.Add(k, g.expand(t, index))
+		}
+	}
+	return &BaseRequest{request: req}, nil
+}
+
+// Generate sends requests starting from offset into the Queue.
+// It blocks when Queue is full, so requests are created only when they can be crawled.
+// It returns offset of the next Request, that can be used to resume generating.
+func (g *Generator) Generate(ctx context.Context, q Queue, offset int) (int, error) {
+	for n := offset; n < g.Len(); n++ {
+		r, err := g.Request(n)
+		if err != nil {
+			return n, err
+		}
+		if err := q.Push(ctx, r); err != nil {
+			return n, err
+		}
+	}
+	return g.Len(), nil
+}
+
+func (g *Generator) parse(s string) (t template, err error) {
+	var last int
+	for _, loc := range templateGroup.FindAllStringIndex(s, -1) {
+		values, ok, err := newGroup(s[loc[0]+1 : loc[1]-1])
+		if err != nil {
+			return t, err
+		}
+		if !ok {
+			continue
+		}
+		t.parts = append(t.parts, s[last:loc[0]])
+		t.values = append(t.values, len(g.values))
+		g.values = append(g.values, values)
+		last = loc[1]
+	}
+	t.parts = append(t.parts, s[last:])
+	return t, nil
+}
+
+func (g *Generator) expand(t template, index []int) string {
+	var b strings.Builder
+	for i, part := range t.parts {
+		b.WriteString(part)
+		if i < len(t.values) {
+			v := t.values[i]
+			b.WriteString(g.values[v].value(index[v]))
+		}
+	}
+	return b.String()
+}
+
+// newGroup parses values of the group, ok is false when group is not a template.
+func newGroup(s string) (g group, ok bool, err error) {
+	if m := templateRange.FindStringSubmatch(s); m != nil {
+		from, err := strconv.Atoi(m[1])
+		if err != nil {
+			return g, false, ErrorTemplate(s)
+		}
+		to, err := strconv.Atoi(m[2])
+		if err != nil {
+			return g, false, ErrorTemplate(s)
+		}
+		step := 1
+		if m[3] != "" {
+			if step, err = strconv.Atoi(m[3]); err != nil {
+				return g, false, ErrorTemplate(s)
+			}
+		}
+		if step <= 0 {
+			return g, false, ErrorTemplate(s)
+		}
+		g = group{from: from, step: step}
+		if len(m[1]) > 1 && m[1][0] == '0' {
+			g.width = len(m[1])
+		}
+		// difference of ints always fits in uint64
+		var distance uint64
+		if from > to {
+			g.step = -step
+			distance = uint64(from) - uint64(to)
+		} else {
+			distance = uint64(to) - uint64(from)
+		}
+		if distance/uint64(step) >= uint64(maxInt) {
+			return g, false, ErrorTemplate(s)
+		}
+		g.n = int(distance/uint64(step)) + 1
+		return g, true, nil
+	}
+	if templateList.MatchString(s) {
+		return group{list: strings.Split(s, ",")}, true, nil
+	}
+	return g, false, nil
+}
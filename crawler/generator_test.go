@@ -0,0 +1,114 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestGenerator(t *testing.T) {
+	g, err := NewGenerator("POST",
+		"http://localhost/search?page={1..3}&cat={a,b}",
+		http.Header{"X-Page": {"{08..10}"}},
+		`{"q": "{x,y}"}`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Len() != 3*2*3*2 {
+		t.Fatalf("invalid len: %v", g.Len())
+	}
+
+	first, _ := g.Request(0)
+	if first.Request().URL.String() != "http://localhost/search?page=1&cat=a" {
+		t.Errorf("invalid url: %s", first.Request().URL)
+	}
+	last, _ := g.Request(g.Len() - 1)
+	if last.Request().URL.String() != "http://localhost/search?page=3&cat=b" {
+		t.Errorf("invalid url: %s", last.Request().URL)
+	}
+	if last.Request().Header.Get("X-Page") != "10" {
+		t.Errorf("invalid header: %s", last.Request().Header.Get("X-Page"))
+	}
+	if b, _ := ioutil.ReadAll(last.Request().Body); string(b) != `{"q": "y"}` {
+		t.Errorf("invalid body: %s", b)
+	}
+	second, _ := g.Request(1)
+	if second.Request().Header.Get("X-Page") != "08" {
+		t.Errorf("invalid header: %s", second.Request().Header.Get("X-Page"))
+	}
+	if _, err := g.Request(g.Len()); err == nil {
+		t.Error("request out of range")
+	}
+
+	if g, _ := NewGenerator("GET", "http://localhost/{10..0..5}", nil, ""); g.Len() != 3 {
+		t.Errorf("invalid len: %v", g.Len())
+	}
+	if _, err := NewGenerator("GET", "http://localhost/{0..10..0}", nil, ""); err == nil {
+		t.Error("invalid step accepted")
+	}
+
+	// values of ranges are not allocated up front
+	g, err = NewGenerator("GET", "http://localhost/{1..20000000000}/{010..0..5}", nil, "")
+	if err != nil || g.Len() != 20000000000*3 {
+		t.Fatalf("invalid len: %v %v", g.Len(), err)
+	}
+	if r, _ := g.Request(g.Len() - 2); r.Request().URL.Path != "/20000000000/005" {
+		t.Errorf("invalid url: %s", r.Request().URL)
+	}
+	for _, url := range []string{
+		"http://localhost/{-9223372036854775808..9223372036854775807}",
+		"http://localhost/{0..99999999999999999999}",
+		"http://localhost/{1..4294967296}/{1..4294967296}",
+	} {
+		if _, err := NewGenerator("GET", url, nil, ""); err == nil {
+			t.Errorf("too many requests accepted: %s", url)
+		}
+	}
+}
+
+func TestGeneratorGenerate(t *testing.T) {
+	g, _ := NewGenerator("GET", "http://localhost/{1..10}", nil, "")
+	q := NewBufferedQueue(4)
+
+	// queue is full after 4 requests
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	offset, err := g.Generate(ctx, q, 0)
+	if err != context.DeadlineExceeded || offset != 4 {
+		t.Errorf("want offset 4, got: %v %v", offset, err)
+	}
+	for i := 0; i < 4; i++ {
+		q.Pop(context.Background())
+	}
+
+	// resume
+	go func() {
+		for i := 0; i < 6; i++ {
+			q.Pop(context.Background())
+		}
+	}()
+	offset, err = g.Generate(context.Background(), q, offset)
+	if err != nil || offset != 10 {
+		t.Errorf("want offset 10, got: %v %v", offset, err)
+	}
+}
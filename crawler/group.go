@@ -0,0 +1,386 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrorGroupEmpty is returned when Request is pushed to the Group without crawlers.
+var ErrorGroupEmpty = errors.New("group has no crawlers")
+
+// ErrorGroupMember is returned when Group has no crawler with the name.
+type ErrorGroupMember string
+
+func (e ErrorGroupMember) Error() string {
+	return fmt.Sprintf("group has no crawler %q", string(e))
+}
+
+// Group starts, stops and waits for a set of crawlers together.
+// Requests pushed to the Group or to any of its crawlers are sent
+// to the crawler of the first matching route, requests that do not
+// match any route stay in the Queue they were pushed to.
+// Group aggregates Trackers of its crawlers and it can share
+// budget and politeness between them.
+type Group struct {
+	sync.Mutex
+	members []*member
+	routes  []route
+
+	budget     *budget
+	politeness Politeness
+}
+
+// member is a named crawler of the Group.
+type member struct {
+	name    string
+	crawler *Crawler
+	queue   *routedQueue
+}
+
+// route sends requests matching the rule to the crawler.
+type route struct {
+	name  string
+	match func(r Request) bool
+}
+
+// GroupOption configures Group created with NewGroup.
+type GroupOption = func(g *Group)
+
+// NewGroup creates new Group.
+func NewGroup(opts ...GroupOption) *Group {
+	g := &Group{}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// WithGroupPoliteness spaces out requests to the same host sent by all crawlers of the Group.
+var WithGroupPoliteness = func(p Politeness) GroupOption {
+	return func(g *Group) {
+		g.politeness = p
+	}
+}
+
+// WithGroupMaxRequests stops crawlers of the Group once they sent n requests together.
+var WithGroupMaxRequests = func(n int) GroupOption {
+	return withGroupBudget(func(b *budget) {
+		b.maxRequests = n
+	})
+}
+
+// WithGroupMaxDomainRequests stops crawlers of the Group once they sent n requests to any domain together.
+var WithGroupMaxDomainRequests = func(n int) GroupOption {
+	return withGroupBudget(func(b *budget) {
+		b.maxDomainRequests = n
+	})
+}
+
+// WithGroupMaxBytes stops crawlers of the Group once they received n bytes of response bodies together.
+var WithGroupMaxBytes = func(n int64) GroupOption {
+	return withGroupBudget(func(b *budget) {
+		b.maxBytes = n
+	})
+}
+
+// WithGroupMaxDuration stops crawlers of the Group once the crawl took d.
+var WithGroupMaxDuration = func(d time.Duration) GroupOption {
+	return withGroupBudget(func(b *budget) {
+		b.maxDuration = d
+	})
+}
+
+// withGroupBudget modifies budget shared by crawlers of the Group.
+// Exhausted budget stops all crawlers of the Group.
+func withGroupBudget(f func(b *budget)) GroupOption {
+	return func(g *Group) {
+		if g.budget == nil {
+			g.budget = newBudget()
+			g.budget.stop = g.exhaust
+		}
+		f(g.budget)
+	}
+}
+
+// exhaust notifies all crawlers that budget was exhausted, closes their queues and stops them.
+func (g *Group) exhaust(c *Crawler, name Budget) {
+	for _, m := range g.Members() {
+		m.emit(Payload{Event: BudgetExhausted, Worker: -1, Value: name})
+		m.Close()
+	}
+	// this can be called from one of crawling goroutines
+	go g.Stop()
+}
+
+// Add adds Crawler to the Group, shared budget and politeness of the Group
+// are applied to it, politeness of the Group replaces politeness of the Crawler.
+// Queue of the Crawler is wrapped to route requests.
+func (g *Group) Add(name string, c *Crawler) error {
+	defer g.Unlock()
+	g.Lock()
+	for _, m := range g.members {
+		if m.name == name {
+			return fmt.Errorf("group already has crawler %q", name)
+		}
+	}
+	if g.politeness != nil {
+		WithPoliteness(g.politeness)(c)
+	}
+	if g.budget != nil {
+		g.budget.install(c)
+	}
+	m := &member{name: name, crawler: c}
+	m.queue = &routedQueue{Queue: c.Queue, group: g, member: m}
+	c.Queue = m.queue
+	g.members = append(g.members, m)
+	return nil
+}
+
+// Route sends requests matching the rule to the crawler with the name.
+// Routes are matched in order they were added.
+func (g *Group) Route(name string, match func(r Request) bool) error {
+	defer g.Unlock()
+	g.Lock()
+	if g.member(name) == nil {
+		return ErrorGroupMember(name)
+	}
+	g.routes = append(g.routes, route{name: name, match: match})
+	return nil
+}
+
+// Crawler returns crawler of the Group with the name or nil.
+func (g *Group) Crawler(name string) *Crawler {
+	defer g.Unlock()
+	g.Lock()
+	if m := g.member(name); m != nil {
+		return m.crawler
+	}
+	return nil
+}
+
+// Members returns crawlers of the Group in order they were added.
+func (g *Group) Members() []*Crawler {
+	defer g.Unlock()
+	g.Lock()
+	crawlers := make([]*Crawler, len(g.members))
+	for i, m := range g.members {
+		crawlers[i] = m.crawler
+	}
+	return crawlers
+}
+
+func (g *Group) member(name string) *member {
+	for _, m := range g.members {
+		if m.name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// target returns member of the first route matching the Request or nil.
+func (g *Group) target(r Request) *member {
+	defer g.Unlock()
+	g.Lock()
+	for _, route := range g.routes {
+		if route.match(r) {
+			return g.member(route.name)
+		}
+	}
+	return nil
+}
+
+// Push pushes Request to the Queue of the routed crawler.
+// Requests that do not match any route are pushed to the first crawler.
+func (g *Group) Push(ctx context.Context, r Request) error {
+	m := g.target(r)
+	if m == nil {
+		g.Lock()
+		if len(g.members) > 0 {
+			m = g.members[0]
+		}
+		g.Unlock()
+	}
+	if m == nil {
+		return ErrorGroupEmpty
+	}
+	return m.queue.Queue.Push(ctx, r)
+}
+
+// Start starts all crawlers.
+func (g *Group) Start() {
+	for _, c := range g.Members() {
+		c.Start()
+	}
+}
+
+// Stop stops all crawlers concurrently and waits until they are stopped.
+func (g *Group) Stop() {
+	var wg sync.WaitGroup
+	for _, c := range g.Members() {
+		wg.Add(1)
+		go func(c *Crawler) {
+			defer wg.Done()
+			c.Stop()
+		}(c)
+	}
+	wg.Wait()
+}
+
+// Wait waits for all crawlers to finish.
+func (g *Group) Wait() {
+	for _, c := range g.Members() {
+		c.Wait()
+	}
+}
+
+// Exhausted returns Budget of the Group that stopped crawlers or empty string.
+func (g *Group) Exhausted() Budget {
+	if g.budget == nil {
+		return ""
+	}
+	defer g.budget.Unlock()
+	g.budget.Lock()
+	return g.budget.exhausted
+}
+
+// BudgetUsage returns usage of the budget of the Group, duration of the crawl
+// is measured until all crawlers of the Group stopped.
+func (g *Group) BudgetUsage() BudgetUsage {
+	if g.budget == nil {
+		return BudgetUsage{}
+	}
+	return g.budget.usage()
+}
+
+// Requests returns read-only Counter summing requests of all crawlers.
+func (g *Group) Requests() Counter {
+	return &groupCounter{group: g, counter: Tracker.Requests}
+}
+
+// Responses returns read-only Counter summing responses of all crawlers.
+func (g *Group) Responses() Counter {
+	return &groupCounter{group: g, counter: Tracker.Responses}
+}
+
+// Errors returns read-only Counter summing errors of all crawlers.
+func (g *Group) Errors() Counter {
+	return &groupCounter{group: g, counter: Tracker.Errors}
+}
+
+// Len returns count of requests in Queues of all crawlers.
+func (g *Group) Len() (n int) {
+	for _, c := range g.Members() {
+		n += c.Len()
+	}
+	return n
+}
+
+// ErrorClasses returns counts of errors of each class of all crawlers.
+func (g *Group) ErrorClasses() map[ErrorClass]int {
+	sizes := map[ErrorClass]int{}
+	for _, c := range g.Members() {
+		for class, n := range c.ErrorClasses().Sizes() {
+			sizes[class] += n
+		}
+	}
+	return sizes
+}
+
+// GroupStats is a snapshot of counters of the Group.
+type GroupStats struct {
+	Requests  int `json:"requests"`
+	Responses int `json:"responses"`
+	Errors    int `json:"errors"`
+	Queued    int `json:"queued"`
+	// Crawlers are stats of each crawler by its name.
+	Crawlers map[string]GroupStats `json:"crawlers,omitempty"`
+}
+
+// Stats returns stats of the Group and each of its crawlers.
+func (g *Group) Stats() GroupStats {
+	g.Lock()
+	members := append([]*member(nil), g.members...)
+	g.Unlock()
+	stats := GroupStats{Crawlers: map[string]GroupStats{}}
+	for _, m := range members {
+		s := GroupStats{
+			Requests:  m.crawler.Requests().Size(),
+			Responses: m.crawler.Responses().Size(),
+			Errors:    m.crawler.Errors().Size(),
+			Queued:    m.crawler.Len(),
+		}
+		stats.Requests += s.Requests
+		stats.Responses += s.Responses
+		stats.Errors += s.Errors
+		stats.Queued += s.Queued
+		stats.Crawlers[m.name] = s
+	}
+	return stats
+}
+
+// groupCounter sums counters of crawlers of the Group.
+// Add does nothing, counters are modified only by crawlers.
+type groupCounter struct {
+	group   *Group
+	counter func(t Tracker) Counter
+}
+
+func (c *groupCounter) Add(int) {}
+
+func (c *groupCounter) Size() (n int) {
+	for _, crawler := range c.group.Members() {
+		n += c.counter(crawler).Size()
+	}
+	return n
+}
+
+// routedQueue pushes requests matching routes of the Group to queues of other crawlers.
+type routedQueue struct {
+	Queue
+	group  *Group
+	member *member
+}
+
+func (q *routedQueue) Push(ctx context.Context, r Request) error {
+	return q.target(r).Push(ctx, r)
+}
+
+func (q *routedQueue) TryPush(r Request) error {
+	return q.target(r).TryPush(r)
+}
+
+// Pending returns pending requests of the crawler, not of the routed ones.
+func (q *routedQueue) Pending() ([]Request, error) {
+	s, ok := q.Queue.(Snapshotter)
+	if !ok {
+		return nil, ErrorNotSnapshotter
+	}
+	return s.Pending()
+}
+
+// target returns Queue of the routed crawler.
+func (q *routedQueue) target(r Request) Queue {
+	if m := q.group.target(r); m != nil {
+		return m.queue.Queue
+	}
+	return q.Queue
+}
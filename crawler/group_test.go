@@ -0,0 +1,215 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+// drain reads bodies of responses of the crawler and calls next for each of them.
+func drain(c *Crawler, next func(r Response)) {
+	go func() {
+		for r := range c.Response() {
+			if res := r.Response(); res != nil {
+				ioutil.ReadAll(res.Body)
+				res.Body.Close()
+			}
+			if next != nil {
+				next(r)
+			}
+		}
+	}()
+}
+
+func TestGroup(t *testing.T) {
+	var mu sync.Mutex
+	var paths = map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths[r.URL.Path]++
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	g := NewGroup()
+	html := NewCrawler(1, WithQueue(NewBufferedQueue(10)), WithLoggerOutput(ioutil.Discard))
+	api := NewCrawler(1, WithQueue(NewBufferedQueue(10)), WithLoggerOutput(ioutil.Discard))
+	if err := g.Add("html", html); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Add("api", api); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Add("api", api); err == nil {
+		t.Error("want error for duplicated name")
+	}
+	if err := g.Route("missing", nil); err != ErrorGroupMember("missing") {
+		t.Errorf("want ErrorGroupMember, got: %v", err)
+	}
+	g.Route("api", func(r Request) bool {
+		return strings.HasPrefix(r.Request().URL.Path, "/api/")
+	})
+	if g.Crawler("api") != api || g.Crawler("missing") != nil {
+		t.Error("unexpected crawler")
+	}
+
+	// html crawler discovers api urls and pushes them into its own queue
+	drain(html, func(r Response) {
+		if r.Request().URL.Path == "/page" {
+			child, _ := NewChildRequest(r, "GET", ts.URL+"/api/child", nil)
+			go html.Push(html.Context(), child)
+		}
+	})
+	var apiPaths = NewCounter()
+	drain(api, func(r Response) {
+		if strings.HasPrefix(r.Request().URL.Path, "/api/") {
+			apiPaths.Add(1)
+		}
+	})
+
+	for _, path := range []string{"/page", "/api/a", "/api/b"} {
+		r, _ := NewRequest("GET", ts.URL+path, nil)
+		if err := g.Push(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.Start()
+	deadline := time.Now().Add(time.Second * 5)
+	for g.Responses().Size() < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	g.Stop()
+	g.Wait()
+
+	if n := apiPaths.Size(); n != 3 {
+		t.Errorf("want 3 api responses from api crawler, got: %d", n)
+	}
+	if n := html.Responses().Size(); n != 1 {
+		t.Errorf("want 1 response from html crawler, got: %d", n)
+	}
+	stats := g.Stats()
+	if stats.Requests != 4 || stats.Responses != 4 || stats.Crawlers["api"].Responses != 3 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if n := g.Requests().Size(); n != 4 {
+		t.Errorf("want 4 requests, got: %d", n)
+	}
+	// aggregate is read-only
+	g.Requests().Add(1)
+	if n := g.Requests().Size(); n != 4 {
+		t.Errorf("want 4 requests, got: %d", n)
+	}
+}
+
+func TestGroupEmpty(t *testing.T) {
+	r, _ := NewRequest("GET", "http://localhost", nil)
+	if err := NewGroup().Push(context.Background(), r); err != ErrorGroupEmpty {
+		t.Errorf("want ErrorGroupEmpty, got: %v", err)
+	}
+}
+
+func TestGroupBudget(t *testing.T) {
+	var served = NewCounter()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+	}))
+	defer ts.Close()
+
+	delay := time.Millisecond * 50
+	g := NewGroup(WithGroupMaxRequests(4), WithGroupPoliteness(NewPoliteness(delay)))
+	// politeness of the Group replaces politeness of the crawler
+	own := countPoliteness{waits: NewCounter()}
+	var crawlers []*Crawler
+	for _, name := range []string{"a", "b"} {
+		c := NewCrawler(1, WithQueue(NewBufferedQueue(10)), WithPoliteness(own), WithLoggerOutput(ioutil.Discard))
+		var exhausted = NewCounter()
+		c.OnEvent(BudgetExhausted, func(e Event, c *Crawler) {
+			exhausted.Add(1)
+		})
+		defer func(name string) {
+			if exhausted.Size() != 1 {
+				t.Errorf("crawler %s: want BudgetExhausted event", name)
+			}
+		}(name)
+		g.Add(name, c)
+		drain(c, nil)
+		crawlers = append(crawlers, c)
+		for i := 0; i < 5; i++ {
+			r, _ := NewRequest("GET", ts.URL, nil)
+			c.Push(context.Background(), r)
+		}
+	}
+
+	start := time.Now()
+	g.Start()
+	g.Wait()
+
+	if g.Exhausted() != BudgetRequests {
+		t.Errorf("want %s, got: %s", BudgetRequests, g.Exhausted())
+	}
+	if n := served.Size(); n != 4 {
+		t.Errorf("want 4 requests, got: %d", n)
+	}
+	// politeness is shared, so requests of both crawlers are spaced out
+	if took := time.Since(start); took < delay*3 {
+		t.Errorf("want requests spaced out by %s, took: %s", delay, took)
+	}
+	if n := own.waits.Size(); n != 0 {
+		t.Errorf("politeness of the crawler waited %d times", n)
+	}
+}
+
+func TestGroupBudgetElapsed(t *testing.T) {
+	g := NewGroup(WithGroupMaxDuration(time.Hour))
+	for _, name := range []string{"a", "b"} {
+		c := NewCrawler(1, WithLoggerOutput(ioutil.Discard))
+		g.Add(name, c)
+		drain(c, nil)
+	}
+	g.Start()
+	time.Sleep(time.Millisecond * 50)
+	g.Members()[0].Stop()
+	time.Sleep(time.Millisecond * 50)
+	// crawl goes on while any of the crawlers runs
+	if elapsed := g.BudgetUsage().Elapsed; elapsed < time.Millisecond*100 {
+		t.Errorf("want elapsed at least 100ms, got: %s", elapsed)
+	}
+	g.Stop()
+	elapsed := g.BudgetUsage().Elapsed
+	time.Sleep(time.Millisecond * 20)
+	if g.BudgetUsage().Elapsed != elapsed {
+		t.Error("elapsed time measured after crawlers stopped")
+	}
+}
+
+// countPoliteness counts calls of Wait without waiting.
+type countPoliteness struct {
+	Politeness
+	waits Counter
+}
+
+func (p countPoliteness) Wait(host string) {
+	p.waits.Add(1)
+}
@@ -0,0 +1,278 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package har
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bukowa/micro/crawler"
+)
+
+// Recorder records each Response received by the Crawler as HAR Entry.
+// It has to be safe to use by multiple goroutines.
+type Recorder struct {
+	sync.Mutex
+
+	bodies  bool
+	entries []Entry
+}
+
+// NewRecorder creates new Recorder.
+// If bodies is true, request and response bodies are stored in the archive.
+func NewRecorder(bodies bool) *Recorder {
+	return &Recorder{
+		bodies:  bodies,
+		entries: []Entry{},
+	}
+}
+
+// WithRecorder registers Recorder on the Crawler.
+// Recorder should be registered as a last option, so
+// it can record Response after all other modifications.
+var WithRecorder = func(r *Recorder) crawler.Option {
+	return func(c *crawler.Crawler) {
+		c.OnResponse(func(i int, c *crawler.Crawler, response crawler.Response) error {
+			r.Record(response)
+			return nil
+		})
+	}
+}
+
+// Record creates Entry from the Response.
+// When bodies are recorded, Response body is read and replaced
+// with in-memory copy, so it can be still read by the caller.
+func (r *Recorder) Record(response crawler.Response) {
+	var took = response.Time()
+	var entry = Entry{
+		StartedDateTime: time.Now().Add(-took).Format(time.RFC3339Nano),
+		Request:         r.request(response.Request()),
+		Timings:         timings(response),
+	}
+	if err := response.Error(); err != nil {
+		entry.Error = err.Error()
+	}
+	if res := response.Response(); res != nil {
+		var receive time.Duration
+		entry.Response, receive = r.response(res)
+		entry.Timings.Receive = milliseconds(receive)
+	}
+	entry.Time = entry.Timings.Wait + entry.Timings.Receive
+	// ssl time is part of connect time
+	for _, t := range []float64{entry.Timings.DNS, entry.Timings.Connect} {
+		if t > 0 {
+			entry.Time += t
+		}
+	}
+
+	defer r.Unlock()
+	r.Lock()
+	r.entries = append(r.entries, entry)
+}
+
+// HAR returns archive of all recorded entries.
+func (r *Recorder) HAR() HAR {
+	defer r.Unlock()
+	r.Lock()
+	entries := make([]Entry, len(r.entries))
+	copy(entries, r.entries)
+	return HAR{Log: Log{
+		Version: Version,
+		Creator: Creator{Name: "micro", Version: Version},
+		Entries: entries,
+	}}
+}
+
+// WriteTo writes archive as json into w.
+func (r *Recorder) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(r.HAR(), "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// WriteFile writes archive as json into file.
+func (r *Recorder) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := r.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (r *Recorder) request(req *http.Request) Request {
+	var request = Request{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: req.Proto,
+		Cookies:     cookies(req.Cookies()),
+		Headers:     headers(req.Header),
+		QueryString: []NameValue{},
+		HeadersSize: -1,
+		BodySize:    req.ContentLength,
+	}
+	request.QueryString = nameValues(req.URL.Query())
+	// body of the request is already consumed by http.Client
+	// but it can be recreated when GetBody is set
+	if r.bodies && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			b, err := ioutil.ReadAll(body)
+			body.Close()
+			if err == nil {
+				request.PostData = &PostData{
+					MimeType: req.Header.Get("Content-Type"),
+					Text:     string(b),
+				}
+			}
+		}
+	}
+	return request
+}
+
+func (r *Recorder) response(res *http.Response) (Response, time.Duration) {
+	var response = Response{
+		Status:      res.StatusCode,
+		StatusText:  http.StatusText(res.StatusCode),
+		HTTPVersion: res.Proto,
+		Cookies:     cookies(res.Cookies()),
+		Headers:     headers(res.Header),
+		Content: Content{
+			Size:     res.ContentLength,
+			MimeType: res.Header.Get("Content-Type"),
+		},
+		RedirectURL: res.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    res.ContentLength,
+	}
+	if !r.bodies || res.Body == nil {
+		return response, 0
+	}
+
+	start := time.Now()
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	took := time.Since(start)
+	if err != nil {
+		// partial body is followed by the error, so it's not mistaken for a complete one
+		res.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(b), errorReader{err}))
+		return response, took
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	response.BodySize = int64(len(b))
+	response.Content.Size = int64(len(b))
+	if utf8.Valid(b) {
+		response.Content.Text = string(b)
+	} else {
+		response.Content.Text = base64.StdEncoding.EncodeToString(b)
+		response.Content.Encoding = "base64"
+	}
+	return response, took
+}
+
+// timings returns Timings of the Response, connection phases
+// are known only for responses implementing Timing().
+func timings(response crawler.Response) Timings {
+	var took = response.Time()
+	var t = Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: milliseconds(took)}
+	if _, ok := response.(interface{ Timing() crawler.Timing }); !ok {
+		return t
+	}
+	timing := crawler.ResponseTiming(response)
+	if timing.Reused {
+		return t
+	}
+	// connect time includes ssl time
+	t.DNS = milliseconds(timing.DNS)
+	t.Connect = milliseconds(timing.Connect + timing.TLSHandshake)
+	if timing.TLSHandshake > 0 {
+		t.SSL = milliseconds(timing.TLSHandshake)
+	}
+	if wait := took - timing.DNS - timing.Connect - timing.TLSHandshake; wait > 0 {
+		t.Wait = milliseconds(wait)
+	} else {
+		t.Wait = 0
+	}
+	return t
+}
+
+// errorReader returns err.
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func headers(h http.Header) []NameValue {
+	return nameValues(h)
+}
+
+// nameValues returns values sorted by name, values of the same name keep their order.
+func nameValues(m map[string][]string) []NameValue {
+	var names = make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var values = []NameValue{}
+	for _, name := range names {
+		for _, v := range m[name] {
+			values = append(values, NameValue{Name: name, Value: v})
+		}
+	}
+	return values
+}
+
+func cookies(c []*http.Cookie) []Cookie {
+	var values = []Cookie{}
+	for _, cookie := range c {
+		var expires string
+		if !cookie.Expires.IsZero() {
+			expires = cookie.Expires.Format(time.RFC3339)
+		}
+		values = append(values, Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Domain:   cookie.Domain,
+			Expires:  expires,
+			HTTPOnly: cookie.HttpOnly,
+			Secure:   cookie.Secure,
+		})
+	}
+	return values
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package har_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bukowa/micro/crawler"
+	. "github.com/bukowa/micro/crawler/har"
+)
+
+func TestRecorder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(201)
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	recorder := NewRecorder(true)
+	c := crawler.NewCrawler(1, WithRecorder(recorder), crawler.WithLoggerOutput(ioutil.Discard))
+	c.Start()
+
+	req, _ := crawler.NewRequest("POST", ts.URL+"?z=2&q=1&a=3", strings.NewReader("body"))
+	c.Push(context.Background(), req)
+	res := <-c.Response()
+
+	// body has to be readable after recording
+	b, err := ioutil.ReadAll(res.Response().Body)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(b) != "hello" {
+		t.Errorf("body not restored: %s", b)
+	}
+
+	bad, _ := crawler.NewRequest("GET", "invalid", nil)
+	c.Push(context.Background(), bad)
+	<-c.Response()
+
+	c.Stop()
+	c.Wait()
+
+	var buf = bytes.NewBuffer(nil)
+	if _, err := recorder.WriteTo(buf); err != nil {
+		t.Error(err)
+	}
+	var archive HAR
+	if err := json.Unmarshal(buf.Bytes(), &archive); err != nil {
+		t.Fatal(err)
+	}
+	if archive.Log.Version != Version {
+		t.Errorf("invalid version: %s", archive.Log.Version)
+	}
+	if len(archive.Log.Entries) != 2 {
+		t.Fatalf("want 2 entries, got: %v", len(archive.Log.Entries))
+	}
+
+	entry := archive.Log.Entries[0]
+	if entry.Request.Method != "POST" || entry.Request.PostData == nil || entry.Request.PostData.Text != "body" {
+		t.Errorf("invalid request: %+v", entry.Request)
+	}
+	var query []string
+	for _, q := range entry.Request.QueryString {
+		query = append(query, q.Name+"="+q.Value)
+	}
+	if strings.Join(query, "&") != "a=3&q=1&z=2" {
+		t.Errorf("invalid query string: %+v", entry.Request.QueryString)
+	}
+	for i := 1; i < len(entry.Response.Headers); i++ {
+		if entry.Response.Headers[i-1].Name > entry.Response.Headers[i].Name {
+			t.Errorf("headers not sorted: %+v", entry.Response.Headers)
+		}
+	}
+	// new connection has known connection timings
+	if entry.Timings.DNS < 0 || entry.Timings.Connect < 0 || entry.Timings.SSL != -1 {
+		t.Errorf("invalid timings: %+v", entry.Timings)
+	}
+	if entry.Response.Status != 201 || entry.Response.Content.Text != "hello" {
+		t.Errorf("invalid response: %+v", entry.Response)
+	}
+	if entry.Response.Content.MimeType != "text/plain" {
+		t.Errorf("invalid mime type: %s", entry.Response.Content.MimeType)
+	}
+
+	if archive.Log.Entries[1].Error == "" {
+		t.Error("error not recorded")
+	}
+}
+
+func TestRecorderBodyError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	recorder := NewRecorder(true)
+	c := crawler.NewCrawler(1, WithRecorder(recorder), crawler.WithLoggerOutput(ioutil.Discard))
+	c.Start()
+	defer c.Stop()
+	req, _ := crawler.NewRequest("GET", ts.URL, nil)
+	c.Push(context.Background(), req)
+	res := <-c.Response()
+
+	// partial body is followed by the read error
+	b, err := ioutil.ReadAll(res.Response().Body)
+	if string(b) != "hello" || err == nil {
+		t.Errorf("want partial body and error, got %q %v", b, err)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrorBodyTooLarge is an error of responses with body larger than limit set with WithMaxBodySize.
+type ErrorBodyTooLarge int64
+
+func (e ErrorBodyTooLarge) Error() string {
+	return fmt.Sprintf("body larger than %d bytes", int64(e))
+}
+
+// WithMaxBodySize limits size of response bodies to n bytes.
+// Responses with larger Content-Length have ErrorBodyTooLarge and no body,
+// reading larger bodies of other responses fails with ErrorBodyTooLarge.
+var WithMaxBodySize = func(n int64) Option {
+	return func(c *Crawler) {
+		c.maxBody = n
+	}
+}
+
+// limitBody applies limit of the response body.
+func (c *Crawler) limitBody(res *http.Response, err error) (*http.Response, error) {
+	if c.maxBody <= 0 || err != nil || res == nil || res.Body == nil {
+		return res, err
+	}
+	if res.ContentLength > c.maxBody {
+		res.Body.Close()
+		res.Body = http.NoBody
+		return res, ErrorBodyTooLarge(c.maxBody)
+	}
+	res.Body = &limitedBody{ReadCloser: res.Body, limit: c.maxBody}
+	return res, nil
+}
+
+// limitedBody fails once more than limit bytes were read.
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.read > b.limit {
+		return 0, ErrorBodyTooLarge(b.limit)
+	}
+	// read one byte over the limit to find out if body is larger
+	if left := b.limit - b.read + 1; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		return n - int(b.read-b.limit), ErrorBodyTooLarge(b.limit)
+	}
+	return n, err
+}
@@ -0,0 +1,86 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	// chunked body without Content-Length
+	chunked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0123456789"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("a"))
+	}))
+	defer chunked.Close()
+	if err := readBodyError(chunked.URL, WithMaxBodySize(10)); !IsBodyTooLarge(err) {
+		t.Errorf("want body too large, got %v", err)
+	}
+	if err := readBodyError(chunked.URL, WithMaxBodySize(11)); err != nil {
+		t.Errorf("body within limit failed: %v", err)
+	}
+
+	// known Content-Length fails before body is read
+	large := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 100)))
+	}))
+	defer large.Close()
+	if err := readBodyError(large.URL, WithMaxBodySize(99)); err != ErrorBodyTooLarge(99) {
+		t.Errorf("want ErrorBodyTooLarge, got %v", err)
+	}
+}
+
+func TestMaxBodySizeErrorClass(t *testing.T) {
+	chunked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0123456789"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("a"))
+	}))
+	defer chunked.Close()
+
+	c := NewCrawler(1, WithMaxBodySize(10), WithLoggerOutput(ioutil.Discard))
+	var events []Payload
+	c.Subscribe(ErrorEvent, func(p Payload) {
+		events = append(events, p)
+	})
+	c.Start()
+	defer c.Stop()
+	r, _ := NewRequest("GET", chunked.URL, nil)
+	c.Push(context.Background(), r)
+	res := <-c.Response()
+	// body error is counted once
+	for i := 0; i < 2; i++ {
+		if _, err := ioutil.ReadAll(res.Response().Body); !IsBodyTooLarge(err) {
+			t.Errorf("want body too large, got %v", err)
+		}
+	}
+	res.Response().Body.Close()
+
+	if sizes := c.ErrorClasses().Sizes(); len(sizes) != 1 || sizes[ClassBodyTooLarge] != 1 {
+		t.Errorf("invalid error classes: %v", sizes)
+	}
+	if len(events) != 1 || events[0].Worker != -1 || events[0].Value != ClassBodyTooLarge || events[0].Request != r {
+		t.Errorf("invalid error events: %+v", events)
+	}
+}
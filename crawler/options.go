@@ -72,6 +72,39 @@ var WithSleep = func(t time.Duration) Option {
 	}
 }
 
+// WithSeen abandons requests that were already crawled.
+var WithSeen = func(seen Seen) Option {
+	return func(c *Crawler) {
+		c.seen = seen
+		c.OnRequest(func(i int, c *Crawler, r Request) error {
+			if _, ok := r.(*retried); ok {
+				seen.Add(c.RequestKey(r))
+				return nil
+			}
+			if !seen.Add(c.RequestKey(r)) {
+				return ErrorSeen
+			}
+			return nil
+		})
+	}
+}
+
+// WithPoliteness delays requests sent to the same host.
+// It replaces Politeness set before.
+var WithPoliteness = func(p Politeness) Option {
+	return func(c *Crawler) {
+		if c.politeness == nil {
+			c.OnRequest(func(i int, c *Crawler, r Request) error {
+				if p := c.politeness; p != nil {
+					p.Wait(r.Request().URL.Host)
+				}
+				return nil
+			})
+		}
+		c.politeness = p
+	}
+}
+
 var WithRequestLog = func(f func(i int, c *Crawler, r Request) string) Option {
 	return func(c *Crawler) {
 		c.OnRequest(func(i int, c *Crawler, r Request) error {
@@ -90,14 +123,12 @@ var WithResponseLog = func(f func(i int, c *Crawler, r Response) string) Option
 	}
 }
 
-
 var WithDefaultRequestLog = func() Option {
 	return WithRequestLog(func(i int, c *Crawler, r Request) string {
 		return fmt.Sprintf("%v:request:%s", i, r.Request().URL.String())
 	})
 }
 
-
 var WithDefaultResponseLog = func() Option {
 	return WithResponseLog(func(i int, c *Crawler, r Response) string {
 		return fmt.Sprintf("%v:response:%s:err:%s", i, r.Request().URL.String(), r.Error())
@@ -132,7 +163,6 @@ var WithStoppedLog = func() Option {
 	return WithEventLog(Stopped, Stopped)
 }
 
-
 var WithDefaultLog = func(c *Crawler) {
 	WithDefaultRequestLog()(c)
 	WithDefaultResponseLog()(c)
@@ -141,4 +171,4 @@ var WithDefaultLog = func(c *Crawler) {
 	WithStartedLog()(c)
 	WithStoppedLog()(c)
 	WithWaitLog()(c)
-}
\ No newline at end of file
+}
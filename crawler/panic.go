@@ -0,0 +1,84 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// ErrorPanic is an error of Response created from panic recovered by the Crawler.
+type ErrorPanic struct {
+	Value interface{}
+	Stack []byte
+	// Responded is true when Response of the Request was counted before
+	// the panic, for example when ResponseEvent subscriber panicked.
+	Responded bool
+}
+
+func (e *ErrorPanic) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// WithMaxPanics stops the Crawler after n recovered panics.
+var WithMaxPanics = func(n int) Option {
+	return func(c *Crawler) {
+		c.maxPanics = n
+	}
+}
+
+// Panics returns Counter of recovered panics.
+func (c *Crawler) Panics() Counter {
+	return c.panics
+}
+
+// recovered sends Response with ErrorPanic into Response() channel.
+// Default NewResponse is used because custom NewResponseFunc may be the one that panicked.
+// Request that panicked before it was counted, for example in OnRequest function,
+// is counted, so Requests, Responses and Errors counters stay consistent.
+// Response is not counted again if it was counted before the panic.
+func (c *Crawler) recovered(i int, request Request, counted, responded bool, v interface{}) {
+	err := &ErrorPanic{Value: v, Stack: debug.Stack(), Responded: responded}
+	response := NewResponse(c, 0, request, nil, err)
+
+	c.Panics().Add(1)
+	if !counted {
+		c.Requests().Add(1)
+	}
+	if !responded {
+		c.Responses().Add(1)
+		c.Errors().Add(1)
+		c.ErrorClasses().Counter(ClassPanic).Add(1)
+	}
+	c.emitPanic(Payload{Event: PanicEvent, Worker: i, Request: request, Response: response, Error: err, Value: v})
+
+	if c.maxPanics > 0 && c.Panics().Size() >= c.maxPanics {
+		// Stop waits for all goroutines to return
+		// and this is called from one of them
+		go c.Stop()
+	}
+	c.send(response)
+}
+
+// emitPanic emits PanicEvent, panics of its subscribers are only logged.
+func (c *Crawler) emitPanic(p Payload) {
+	defer func() {
+		if v := recover(); v != nil {
+			c.Print("panic of ", PanicEvent, " subscriber: ", v)
+		}
+	}()
+	c.emit(p)
+}
@@ -0,0 +1,159 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestPanic(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var panics = make(chan Payload, 2)
+	c := NewCrawler(1,
+		WithMaxPanics(2),
+		WithLoggerOutput(ioutil.Discard),
+		WithResponseFunc(func(c *Crawler, took time.Duration, req Request, res *http.Response, err error) Response {
+			if req.Request().URL.Path == "/response" {
+				panic("response")
+			}
+			return NewResponse(c, took, req, res, err)
+		}),
+	)
+	c.OnRequest(func(i int, c *Crawler, r Request) error {
+		if r.Request().URL.Path == "/request" {
+			panic("request")
+		}
+		return nil
+	})
+	c.Subscribe(PanicEvent, func(p Payload) {
+		panics <- p
+	})
+	c.Start()
+
+	for _, path := range []string{"/request", "/", "/response"} {
+		r, _ := NewRequest("GET", ts.URL+path, nil)
+		c.Push(context.Background(), r)
+		res := <-c.Response()
+
+		var errPanic *ErrorPanic
+		if path == "/" {
+			if res.Error() != nil {
+				t.Errorf("worker not recovered: %v", res.Error())
+			}
+			continue
+		}
+		if !errors.As(res.Error(), &errPanic) || errPanic.Value != path[1:] || len(errPanic.Stack) == 0 {
+			t.Errorf("want ErrorPanic, got: %v", res.Error())
+		}
+		if p := <-panics; p.Request != r || p.Value != path[1:] {
+			t.Errorf("invalid payload: %+v", p)
+		}
+	}
+
+	// crawler stops after 2 panics
+	c.Wait()
+	if c.Panics().Size() != 2 || c.Errors().Size() != 2 || c.Responses().Size() != 3 || c.Requests().Size() != 3 {
+		t.Errorf("invalid counters: %v %v %v %v", c.Panics().Size(), c.Errors().Size(), c.Responses().Size(), c.Requests().Size())
+	}
+}
+
+func TestPanicSubscriber(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	reporter := NewReporter(time.Second, 2)
+	c := NewCrawler(1, WithReport(reporter), WithLoggerOutput(ioutil.Discard))
+	c.Subscribe(ResponseEvent, func(p Payload) {
+		panic("response")
+	})
+	// panic of PanicEvent subscriber does not stop the worker
+	c.Subscribe(PanicEvent, func(p Payload) {
+		panic("panic")
+	})
+	c.Start()
+	for i := 0; i < 2; i++ {
+		r, _ := NewRequest("GET", ts.URL, nil)
+		c.Push(context.Background(), r)
+		var errPanic *ErrorPanic
+		if res := <-c.Response(); !errors.As(res.Error(), &errPanic) || !errPanic.Responded {
+			t.Errorf("want ErrorPanic of responded request, got: %v", res.Error())
+		}
+	}
+	c.Stop()
+
+	// response counted before the panic is not counted again
+	if c.Panics().Size() != 2 || c.Responses().Size() != 2 || c.Errors().Size() != 0 || c.ErrorClasses().Counter(ClassPanic).Size() != 0 {
+		t.Errorf("invalid counters: %v %v %v", c.Panics().Size(), c.Responses().Size(), c.Errors().Size())
+	}
+	if report := reporter.Report(); report.Responses != 2 || report.Errors != 0 {
+		t.Errorf("invalid report: %v %v", report.Responses, report.Errors)
+	}
+}
+
+// roundTripFunc implements http.RoundTripper.
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestPanicClosesBody(t *testing.T) {
+	var closed = &int32Counter{}
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := closeBody{ReadCloser: ioutil.NopCloser(strings.NewReader("body")), closed: closed}
+		return &http.Response{StatusCode: 200, Body: body, Request: req}, nil
+	})}
+	c := NewCrawler(1, WithClient(client), WithQueue(NewBufferedQueue(10)), WithLoggerOutput(ioutil.Discard))
+	c.OnResponse(func(i int, c *Crawler, r Response) error {
+		panic("response")
+	})
+	c.Start()
+	r, _ := NewRequest("GET", "http://localhost/", nil)
+	c.Push(context.Background(), r)
+	<-c.Response()
+	closed.Lock()
+	if closed.n != 1 {
+		t.Error("body of response not closed")
+	}
+	closed.Unlock()
+
+	// stopped crawler does not block on responses nobody receives
+	for i := 0; i < 5; i++ {
+		r, _ := NewRequest("GET", "http://localhost/", nil)
+		c.Push(context.Background(), r)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		c.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second * 5):
+		t.Error("crawler blocked on sending responses")
+	}
+}
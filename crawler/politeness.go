@@ -0,0 +1,80 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"sync"
+	"time"
+)
+
+// Politeness spaces out requests sent to the same host.
+// It has to be safe to use by multiple goroutines.
+type Politeness interface {
+	// Wait blocks until request to the host is allowed.
+	Wait(host string)
+	// State returns time after which next request to each host is allowed.
+	State() map[string]time.Time
+	Restore(state map[string]time.Time)
+}
+
+// NewPoliteness creates new Politeness allowing one request per delay to each host.
+func NewPoliteness(delay time.Duration) Politeness {
+	return &BasePoliteness{
+		delay: delay,
+		next:  map[string]time.Time{},
+	}
+}
+
+// BasePoliteness implements Politeness.
+type BasePoliteness struct {
+	sync.Mutex
+	delay time.Duration
+	next  map[string]time.Time
+}
+
+// Wait blocks until request to the host is allowed.
+func (p *BasePoliteness) Wait(host string) {
+	p.Lock()
+	now := time.Now()
+	slot := now
+	if next, ok := p.next[host]; ok && next.After(now) {
+		slot = next
+	}
+	p.next[host] = slot.Add(p.delay)
+	p.Unlock()
+	time.Sleep(slot.Sub(now))
+}
+
+// State returns time after which next request to each host is allowed.
+func (p *BasePoliteness) State() map[string]time.Time {
+	defer p.Unlock()
+	p.Lock()
+	state := make(map[string]time.Time, len(p.next))
+	for host, t := range p.next {
+		state[host] = t
+	}
+	return state
+}
+
+// Restore replaces state.
+func (p *BasePoliteness) Restore(state map[string]time.Time) {
+	defer p.Unlock()
+	p.Lock()
+	p.next = make(map[string]time.Time, len(state))
+	for host, t := range state {
+		p.next[host] = t
+	}
+}
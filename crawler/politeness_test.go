@@ -0,0 +1,52 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestPoliteness(t *testing.T) {
+	var delay = time.Millisecond * 50
+	var p = NewPoliteness(delay)
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			p.Wait("a")
+		}()
+		go func() {
+			defer wg.Done()
+			p.Wait("b")
+		}()
+	}
+	wg.Wait()
+
+	took := time.Since(start)
+	if took < delay*3 || took > delay*5 {
+		t.Errorf("took: %s", took)
+	}
+	if len(p.State()) != 2 {
+		t.Errorf("invalid state: %v", p.State())
+	}
+}
@@ -15,23 +15,225 @@ limitations under the License.
 */
 package crawler
 
-// Queue represents communication betwee caller and the crawler.
-// Crawler performs requests received from Request() method.
-// Once the request is completed its send into Response() method.
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// ErrorQueueClosed is returned by Queue that was closed.
+var ErrorQueueClosed = errors.New("queue closed")
+
+// ErrorQueueFull is returned by TryPush when Queue cannot accept more requests.
+var ErrorQueueFull = errors.New("queue full")
+
+// ErrorQueueUntracked is returned by Pending of adapted Queue when requests
+// were sent directly into the channel of ChanQueue.
+var ErrorQueueUntracked = errors.New("queue has requests not pushed through it")
+
+// Queue holds requests waiting to be performed by the Crawler.
+// Implementations have to be safe to use by multiple goroutines,
+// so they can be backed by channels, databases or remote services.
 type Queue interface {
+	// Push adds Request to the Queue, it blocks while Queue is full
+	// until ctx is done. Request is added if Queue is not full even if ctx
+	// is already done. It returns ErrorQueueClosed once Queue is closed.
+	Push(ctx context.Context, r Request) error
+	// Pop removes Request from the Queue, it blocks while Queue is empty
+	// until ctx is done. Requests that are immediately available are returned
+	// even if ctx is already done. Closed Queue returns remaining requests
+	// and then ErrorQueueClosed.
+	Pop(ctx context.Context) (Request, error)
+	// TryPush adds Request without blocking, it returns ErrorQueueFull if Queue is full.
+	TryPush(r Request) error
+	// Len returns count of requests waiting in the Queue.
+	Len() int
+	// Close stops accepting requests.
+	Close() error
+}
+
+// Snapshotter is implemented by Queue that can list its requests without removing them.
+type Snapshotter interface {
+	// Pending returns requests waiting in the Queue in order they are popped.
+	Pending() ([]Request, error)
+}
+
+// ChanQueue represents communication between caller and the crawler with channels.
+// Crawler performs requests received from Request() channel.
+// Once the request is completed its send into Response() channel.
+type ChanQueue interface {
 	Response() chan Response
 	Request() chan Request
 }
 
-// NewQueue creates new Queue.
+// NewQueue creates new Queue buffering up to requestSize requests and responseSize responses.
 func NewQueue(requestSize, responseSize int) Queue {
+	return AdaptQueue(NewBaseQueue(requestSize, responseSize))
+}
+
+// NewBufferedQueue creates new Queue buffering up to size requests and responses.
+func NewBufferedQueue(size int) Queue {
+	return NewQueue(size, size)
+}
+
+// AdaptQueue adapts ChanQueue to the Queue.
+// Crawler using adapted Queue sends responses into its Response() channel.
+// Requests sent directly into Request() channel are performed,
+// but adapted Queue cannot list them in its Pending requests.
+func AdaptQueue(q ChanQueue) Queue {
+	return &chanQueue{ChanQueue: q, closed: make(chan struct{}), space: make(chan struct{})}
+}
+
+// chanQueue implements Queue with ChanQueue.
+// It keeps requests sent into the channel in the same order,
+// so they can be listed without taking them out of the channel.
+type chanQueue struct {
+	ChanQueue
+	closed chan struct{}
+	once   sync.Once
+
+	mu      sync.Mutex
+	pending []Request
+	// space is closed and replaced once Request was popped
+	space chan struct{}
+}
+
+func (q *chanQueue) Push(ctx context.Context, r Request) error {
+	for {
+		q.mu.Lock()
+		err := q.tryPush(r)
+		space := q.space
+		q.mu.Unlock()
+		if err != ErrorQueueFull {
+			return err
+		}
+		select {
+		case <-space:
+		case <-q.closed:
+			return ErrorQueueClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (q *chanQueue) Pop(ctx context.Context) (Request, error) {
+	r, err := q.pop(ctx)
+	if err == nil {
+		q.popped(r)
+	}
+	return r, err
+}
+
+func (q *chanQueue) pop(ctx context.Context) (Request, error) {
+	select {
+	case r := <-q.Request():
+		return r, nil
+	default:
+	}
+	select {
+	case r := <-q.Request():
+		return r, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-q.closed:
+		select {
+		case r := <-q.Request():
+			return r, nil
+		default:
+			return nil, ErrorQueueClosed
+		}
+	}
+}
+
+// popped removes Request from pending requests and wakes up blocked pushes.
+// Requests popped by many goroutines are not removed in order they were
+// received, so the Request is searched for.
+func (q *chanQueue) popped(r Request) {
+	defer q.mu.Unlock()
+	q.mu.Lock()
+	// requests sent directly into the channel are not pending
+	if i := pendingIndex(q.pending, r); i >= 0 {
+		copy(q.pending[i:], q.pending[i+1:])
+		q.pending[len(q.pending)-1] = nil
+		q.pending = q.pending[:len(q.pending)-1]
+	}
+	close(q.space)
+	q.space = make(chan struct{})
+}
+
+func (q *chanQueue) TryPush(r Request) error {
+	defer q.mu.Unlock()
+	q.mu.Lock()
+	return q.tryPush(r)
+}
+
+// tryPush sends Request into the channel, q.mu has to be held,
+// so requests are pending in the same order they are in the channel.
+func (q *chanQueue) tryPush(r Request) error {
+	select {
+	case <-q.closed:
+		return ErrorQueueClosed
+	default:
+	}
+	select {
+	case q.Request() <- r:
+		q.pending = append(q.pending, r)
+		return nil
+	default:
+		return ErrorQueueFull
+	}
+}
+
+func (q *chanQueue) Len() int {
+	return len(q.Request())
+}
+
+// Pending returns requests pushed into the Queue that were not popped yet.
+// It returns ErrorQueueUntracked if channel holds requests that were not
+// pushed through the Queue.
+func (q *chanQueue) Pending() ([]Request, error) {
+	defer q.mu.Unlock()
+	q.mu.Lock()
+	if len(q.Request()) > len(q.pending) {
+		return nil, ErrorQueueUntracked
+	}
+	return append([]Request(nil), q.pending...), nil
+}
+
+// pendingIndex returns index of the first pending Request r or -1.
+// Requests of not comparable types are matched by their type.
+func pendingIndex(pending []Request, r Request) int {
+	t := reflect.TypeOf(r)
+	for i, p := range pending {
+		if reflect.TypeOf(p) != t {
+			continue
+		}
+		if !t.Comparable() || p == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// Close closes the Queue, channels of ChanQueue are not closed.
+func (q *chanQueue) Close() error {
+	q.once.Do(func() {
+		close(q.closed)
+	})
+	return nil
+}
+
+// NewBaseQueue creates new BaseQueue.
+func NewBaseQueue(requestSize, responseSize int) BaseQueue {
 	return BaseQueue{
 		results: make(chan Response, responseSize),
 		request: make(chan Request, requestSize),
 	}
 }
 
-// BaseQueue implements Queue.
+// BaseQueue implements ChanQueue.
 type BaseQueue struct {
 	results chan Response
 	request chan Request
@@ -0,0 +1,177 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestQueue(t *testing.T) {
+	q := NewBufferedQueue(2)
+	a, _ := NewRequest("GET", "http://localhost/a", nil)
+	b, _ := NewRequest("GET", "http://localhost/b", nil)
+	if err := q.Push(context.Background(), a); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.TryPush(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.TryPush(a); err != ErrorQueueFull {
+		t.Errorf("want ErrorQueueFull, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	if err := q.Push(ctx, a); err != context.DeadlineExceeded {
+		t.Errorf("want deadline exceeded, got %v", err)
+	}
+	if q.Len() != 2 {
+		t.Errorf("want len 2, got %d", q.Len())
+	}
+
+	// available requests are returned with done context
+	if r, err := q.Pop(ctx); err != nil || r != a {
+		t.Errorf("want first request, got %v %v", r, err)
+	}
+
+	q.Close()
+	if err := q.Push(context.Background(), a); err != ErrorQueueClosed {
+		t.Errorf("want ErrorQueueClosed, got %v", err)
+	}
+	// closed queue is drained
+	if r, err := q.Pop(context.Background()); err != nil || r != b {
+		t.Errorf("want second request, got %v %v", r, err)
+	}
+	if _, err := q.Pop(context.Background()); err != ErrorQueueClosed {
+		t.Errorf("want ErrorQueueClosed, got %v", err)
+	}
+}
+
+func TestQueueAdapter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	// responses are sent into the channel of adapted queue
+	base := NewBaseQueue(1, 1)
+	c := NewCrawler(1, WithQueue(AdaptQueue(base)), WithLoggerOutput(ioutil.Discard))
+	c.Start()
+	defer c.Stop()
+	r, _ := NewRequest("GET", ts.URL, nil)
+	base.Request() <- r
+	select {
+	case res := <-base.Response():
+		if res.Error() != nil {
+			t.Error(res.Error())
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout")
+	}
+}
+
+// stack is a Queue without channels, returning the last pushed Request.
+type stack struct {
+	sync.Mutex
+	requests []Request
+	closed   bool
+}
+
+func (s *stack) Push(ctx context.Context, r Request) error {
+	return s.TryPush(r)
+}
+
+func (s *stack) Pop(ctx context.Context) (Request, error) {
+	for {
+		s.Lock()
+		if n := len(s.requests); n > 0 {
+			r := s.requests[n-1]
+			s.requests = s.requests[:n-1]
+			s.Unlock()
+			return r, nil
+		}
+		closed := s.closed
+		s.Unlock()
+		if closed {
+			return nil, ErrorQueueClosed
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func (s *stack) TryPush(r Request) error {
+	defer s.Unlock()
+	s.Lock()
+	if s.closed {
+		return ErrorQueueClosed
+	}
+	s.requests = append(s.requests, r)
+	return nil
+}
+
+func (s *stack) Len() int {
+	defer s.Unlock()
+	s.Lock()
+	return len(s.requests)
+}
+
+func (s *stack) Close() error {
+	defer s.Unlock()
+	s.Lock()
+	s.closed = true
+	return nil
+}
+
+func TestCustomQueue(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	q := &stack{}
+	var paths = []string{"/a", "/b", "/c"}
+	for _, path := range paths {
+		r, _ := NewRequest("GET", ts.URL+path, nil)
+		q.Push(context.Background(), r)
+	}
+	q.Close()
+
+	c := NewCrawler(2, WithQueue(q), WithLoggerOutput(ioutil.Discard))
+	c.Start()
+	var got []string
+	for range paths {
+		select {
+		case res := <-c.Response():
+			got = append(got, res.Request().URL.Path)
+		case <-time.After(time.Second * 5):
+			t.Fatal("timeout")
+		}
+	}
+	// workers wait for Stop once closed queue is drained
+	c.Stop()
+	sort.Strings(got)
+	if len(got) != 3 || got[0] != "/a" || got[2] != "/c" {
+		t.Errorf("invalid responses: %v", got)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Redirect is a single redirect hop.
+type Redirect struct {
+	// URL is an url of the redirected request.
+	URL        string
+	StatusCode int
+	Header     http.Header
+	// Location is an url the request was redirected to.
+	Location string
+}
+
+// RedirectPolicy describes what Crawler does with redirects to other domain.
+type RedirectPolicy int
+
+const (
+	// RedirectFollow follows the redirect.
+	RedirectFollow RedirectPolicy = iota
+	// RedirectStop does not follow the redirect, redirect response is sent to the Queue.
+	RedirectStop
+	// RedirectEnqueue does not follow the redirect and sends new Request into the Queue.
+	// Request fails with ErrorQueueFull when the Queue is full.
+	RedirectEnqueue
+)
+
+// ErrorTooManyRedirects is returned when request exceeded maximum number of redirects.
+type ErrorTooManyRedirects int
+
+func (e ErrorTooManyRedirects) Error() string {
+	return fmt.Sprintf("stopped after %d redirects", int(e))
+}
+
+// ResponseRedirects returns redirects taken by the Response.
+// Responses that do not implement Redirects() have no redirects.
+func ResponseRedirects(r Response) []Redirect {
+	if rr, ok := r.(interface{ Redirects() []Redirect }); ok {
+		return rr.Redirects()
+	}
+	return nil
+}
+
+// redirects is a redirect configuration of the Crawler.
+type redirects struct {
+	max         int
+	crossDomain RedirectPolicy
+	dedupe      bool
+}
+
+// WithMaxRedirects sets maximum number of redirects followed by request.
+var WithMaxRedirects = func(n int) Option {
+	return func(c *Crawler) {
+		c.redirects.max = n
+	}
+}
+
+// WithCrossDomainRedirects sets policy for redirects to other domain.
+var WithCrossDomainRedirects = func(p RedirectPolicy) Option {
+	return func(c *Crawler) {
+		c.redirects.crossDomain = p
+	}
+}
+
+// WithRedirectDedupe stops following redirects to requests that were already seen.
+// It requires Seen set with WithSeen, redirect targets are added to Seen.
+var WithRedirectDedupe = func() Option {
+	return func(c *Crawler) {
+		c.redirects.dedupe = true
+	}
+}
+
+// redirectClient returns copy of the client recording redirects
+// and applying redirect configuration before client CheckRedirect.
+func (c *Crawler) redirectClient(client *http.Client) *http.Client {
+	cl := *client
+	check := client.CheckRedirect
+	cl.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := c.checkRedirect(req, via); err != nil {
+			return err
+		}
+		if check != nil {
+			return check(req, via)
+		}
+		return nil
+	}
+	return &cl
+}
+
+func (c *Crawler) checkRedirect(req *http.Request, via []*http.Request) error {
+	t := traceFrom(req.Context())
+	if t != nil && req.Response != nil {
+		t.redirect(Redirect{
+			URL:        via[len(via)-1].URL.String(),
+			StatusCode: req.Response.StatusCode,
+			Header:     req.Response.Header.Clone(),
+			Location:   req.URL.String(),
+		})
+	}
+
+	if len(via) > c.redirects.max {
+		return ErrorTooManyRedirects(len(via) - 1)
+	}
+
+	if req.URL.Hostname() != via[0].URL.Hostname() {
+		switch c.redirects.crossDomain {
+		case RedirectStop:
+			return http.ErrUseLastResponse
+		case RedirectEnqueue:
+			var parent Request = &BaseRequest{request: via[0]}
+			if t != nil && t.parent != nil {
+				parent = t.parent
+			}
+			r, err := NewChildRequest(parent, http.MethodGet, req.URL.String(), nil)
+			if err != nil {
+				return err
+			}
+			// workers must not block on full Queue, so request fails instead
+			if err := c.TryPush(r); err != nil {
+				return err
+			}
+			return http.ErrUseLastResponse
+		}
+	}
+
+	if c.redirects.dedupe && c.seen != nil {
+		if !c.seen.Add(c.RequestKey(&BaseRequest{request: req})) {
+			return http.ErrUseLastResponse
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestRedirects(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+	// other server is available under different host name
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/r3":
+			http.Redirect(w, r, "/r2", http.StatusMovedPermanently)
+		case "/r2":
+			http.Redirect(w, r, "/r1", http.StatusFound)
+		case "/r1", "/a", "/b":
+			http.Redirect(w, r, "/final", http.StatusFound)
+		case "/away":
+			http.Redirect(w, r, otherURL+"/away", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	var do = func(c *Crawler, path string) Response {
+		r, _ := NewRequest("GET", ts.URL+path, nil)
+		c.Push(context.Background(), r)
+		return <-c.Response()
+	}
+
+	t.Run("chain", func(t *testing.T) {
+		c := NewCrawler(1, WithLoggerOutput(ioutil.Discard))
+		c.Start()
+		defer c.Wait()
+		defer c.Stop()
+
+		res := do(c, "/r3")
+		if res.Error() != nil || res.Response().StatusCode != 200 {
+			t.Fatalf("redirect not followed: %v", res.Error())
+		}
+		redirects := ResponseRedirects(res)
+		if len(redirects) != 3 {
+			t.Fatalf("want 3 redirects, got: %v", redirects)
+		}
+		if redirects[0].URL != ts.URL+"/r3" || redirects[0].StatusCode != 301 || redirects[0].Location != ts.URL+"/r2" {
+			t.Errorf("invalid redirect: %+v", redirects[0])
+		}
+		if redirects[2].Location != ts.URL+"/final" || redirects[2].Header.Get("Location") != "/final" {
+			t.Errorf("invalid redirect: %+v", redirects[2])
+		}
+	})
+
+	t.Run("max", func(t *testing.T) {
+		c := NewCrawler(1, WithMaxRedirects(2), WithLoggerOutput(ioutil.Discard))
+		c.Start()
+		defer c.Wait()
+		defer c.Stop()
+
+		var tooMany ErrorTooManyRedirects
+		if res := do(c, "/r3"); !errors.As(res.Error(), &tooMany) || int(tooMany) != 2 {
+			t.Errorf("want ErrorTooManyRedirects, got: %v", res.Error())
+		}
+		if res := do(c, "/r2"); res.Error() != nil {
+			t.Errorf("redirect not followed: %v", res.Error())
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		c := NewCrawler(1, WithCrossDomainRedirects(RedirectStop), WithLoggerOutput(ioutil.Discard))
+		c.Start()
+		defer c.Wait()
+		defer c.Stop()
+
+		res := do(c, "/away")
+		if res.Error() != nil || res.Response().StatusCode != 302 || len(ResponseRedirects(res)) != 1 {
+			t.Errorf("cross domain redirect followed: %v", res.Error())
+		}
+	})
+
+	t.Run("enqueue", func(t *testing.T) {
+		c := NewCrawler(1, WithCrossDomainRedirects(RedirectEnqueue), WithLoggerOutput(ioutil.Discard))
+		var depths = make(chan int, 2)
+		c.Subscribe(RequestEvent, func(p Payload) {
+			depths <- RequestDepth(p.Request)
+		})
+		c.Start()
+		defer c.Wait()
+		defer c.Stop()
+
+		if res := do(c, "/away"); res.Response().StatusCode != 302 {
+			t.Errorf("cross domain redirect followed")
+		}
+		res := <-c.Response()
+		if res.Request().URL.String() != otherURL+"/away" {
+			t.Errorf("redirect not enqueued: %s", res.Request().URL)
+		}
+		if <-depths != 0 || <-depths != 1 {
+			t.Error("enqueued redirect is not a child request")
+		}
+	})
+
+	t.Run("dedupe", func(t *testing.T) {
+		c := NewCrawler(1, WithSeen(NewSeen()), WithRedirectDedupe(), WithLoggerOutput(ioutil.Discard))
+		c.Start()
+		defer c.Wait()
+		defer c.Stop()
+
+		if res := do(c, "/a"); res.Response().StatusCode != 200 {
+			t.Errorf("redirect not followed")
+		}
+		if res := do(c, "/b"); res.Response().StatusCode != 302 {
+			t.Errorf("seen redirect followed")
+		}
+	})
+}
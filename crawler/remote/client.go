@@ -0,0 +1,175 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bukowa/micro/crawler"
+)
+
+// Request is a serializable crawler.Request.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+	Depth  int         `json:"depth,omitempty"`
+}
+
+// NewRequest creates Request from crawler.Request.
+// Body of the request is read and replaced with in-memory copy.
+func NewRequest(r crawler.Request) (Request, error) {
+	request, err := crawler.NewSnapshotRequest(r)
+	return Request(request), err
+}
+
+// Crawler creates crawler.Request from Request, depth of the request is kept.
+func (r Request) Crawler() (crawler.Request, error) {
+	return crawler.SnapshotRequest(r).Restore()
+}
+
+// Lease is a Request handed out to the worker.
+type Lease struct {
+	ID       string    `json:"id"`
+	Worker   string    `json:"worker"`
+	Deadline time.Time `json:"deadline"`
+	Request  Request   `json:"request"`
+}
+
+type message struct {
+	Worker   string    `json:"worker,omitempty"`
+	ID       string    `json:"id,omitempty"`
+	IDs      []string  `json:"ids,omitempty"`
+	Requests []Request `json:"requests,omitempty"`
+}
+
+// ErrorFinished is returned by Lease once the Coordinator finished.
+var ErrorFinished = errors.New("coordinator finished")
+
+// ErrorStatus is returned when Coordinator responds with unexpected status code.
+type ErrorStatus int
+
+func (e ErrorStatus) Error() string {
+	return fmt.Sprintf("coordinator responded with status: %d", int(e))
+}
+
+// Client communicates with the Coordinator over http.
+type Client struct {
+	url    string
+	worker string
+	client *http.Client
+}
+
+// NewClient creates new Client for Coordinator available at url.
+// Worker is a name identifying leases of this Client.
+func NewClient(url, worker string) *Client {
+	return &Client{
+		url:    url,
+		worker: worker,
+		client: &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+// Push adds requests to the Coordinator frontier.
+func (c *Client) Push(requests ...crawler.Request) error {
+	var msg = message{}
+	for _, r := range requests {
+		request, err := NewRequest(r)
+		if err != nil {
+			return err
+		}
+		msg.Requests = append(msg.Requests, request)
+	}
+	_, err := c.post(PathPush, msg, nil)
+	return err
+}
+
+// Lease leases next Request, ok is false if there are no pending requests.
+// It returns ErrorFinished once the Coordinator finished.
+func (c *Client) Lease() (lease Lease, ok bool, err error) {
+	status, err := c.post(PathLease, message{Worker: c.worker}, &lease)
+	if err == nil && status == http.StatusGone {
+		err = ErrorFinished
+	}
+	return lease, status == http.StatusOK, err
+}
+
+// Finish tells the Coordinator that no more requests are pushed, except
+// of those pushed by the workers.
+func (c *Client) Finish() error {
+	_, err := c.post(PathFinish, message{}, nil)
+	return err
+}
+
+// Ack marks lease as done.
+func (c *Client) Ack(id string) error {
+	_, err := c.post(PathAck, message{Worker: c.worker, ID: id}, nil)
+	return err
+}
+
+// Nack returns lease to the Coordinator frontier.
+func (c *Client) Nack(id string) error {
+	_, err := c.post(PathNack, message{Worker: c.worker, ID: id}, nil)
+	return err
+}
+
+// Heartbeat extends leases.
+func (c *Client) Heartbeat(ids ...string) error {
+	_, err := c.post(PathHeartbeat, message{Worker: c.worker, IDs: ids}, nil)
+	return err
+}
+
+// Stats returns Coordinator Stats.
+func (c *Client) Stats() (stats Stats, err error) {
+	res, err := c.client.Get(c.url + PathStats)
+	if err != nil {
+		return stats, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return stats, ErrorStatus(res.StatusCode)
+	}
+	err = json.NewDecoder(res.Body).Decode(&stats)
+	return stats, err
+}
+
+func (c *Client) post(path string, msg message, v interface{}) (int, error) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	res, err := c.client.Post(c.url+path, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		if v != nil {
+			return res.StatusCode, json.NewDecoder(res.Body).Decode(v)
+		}
+	case http.StatusAccepted, http.StatusNoContent, http.StatusGone:
+	default:
+		return res.StatusCode, ErrorStatus(res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
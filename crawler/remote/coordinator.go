@@ -0,0 +1,262 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package remote
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	PathPush      = "/push"
+	PathLease     = "/lease"
+	PathAck       = "/ack"
+	PathNack      = "/nack"
+	PathHeartbeat = "/heartbeat"
+	PathStats     = "/stats"
+	PathFinish    = "/finish"
+)
+
+// Coordinator owns the frontier and hands out requests to workers.
+// Each handed out request is leased for a period of time, if worker
+// does not ack, nack or heartbeat the lease before it expires,
+// request is handed out again with a new lease ID.
+// Leases can be acked or nacked only by the worker holding them.
+// Once Coordinator is finished and none of the requests is pending or leased,
+// frontier is exhausted and workers are told to stop leasing.
+type Coordinator struct {
+	sync.Mutex
+
+	leaseTimeout time.Duration
+	maxAttempts  int
+
+	seq      int
+	pending  []*task
+	leased   map[string]*task
+	stats    Stats
+	finished bool
+}
+
+// Stats describes state of the Coordinator.
+type Stats struct {
+	Pending int `json:"pending"`
+	Leased  int `json:"leased"`
+	Acked   int `json:"acked"`
+	Expired int `json:"expired"`
+	Dropped int `json:"dropped"`
+}
+
+type task struct {
+	id       string
+	lease    Lease
+	attempts int
+}
+
+type CoordinatorOption = func(c *Coordinator)
+
+// WithLeaseTimeout sets time after which not acknowledged lease expires.
+var WithLeaseTimeout = func(t time.Duration) CoordinatorOption {
+	return func(c *Coordinator) {
+		c.leaseTimeout = t
+	}
+}
+
+// WithMaxAttempts sets how many times request is handed out before it is dropped.
+var WithMaxAttempts = func(n int) CoordinatorOption {
+	return func(c *Coordinator) {
+		c.maxAttempts = n
+	}
+}
+
+// NewCoordinator creates new Coordinator.
+func NewCoordinator(opts ...CoordinatorOption) *Coordinator {
+	c := &Coordinator{
+		leaseTimeout: time.Second * 30,
+		maxAttempts:  3,
+		leased:       map[string]*task{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Push adds requests to the frontier.
+func (c *Coordinator) Push(requests ...Request) {
+	defer c.Unlock()
+	c.Lock()
+	for _, r := range requests {
+		c.seq++
+		c.pending = append(c.pending, &task{id: strconv.Itoa(c.seq), lease: Lease{Request: r}})
+	}
+}
+
+// Lease hands out first pending request to the worker.
+func (c *Coordinator) Lease(worker string) (Lease, bool) {
+	defer c.Unlock()
+	c.Lock()
+	c.expire()
+	for len(c.pending) > 0 {
+		t := c.pending[0]
+		c.pending = c.pending[1:]
+		if t.attempts >= c.maxAttempts {
+			c.stats.Dropped++
+			continue
+		}
+		t.attempts++
+		// lease of the previous attempt cannot be acked by a stale worker
+		t.lease.ID = t.id + "." + strconv.Itoa(t.attempts)
+		t.lease.Worker = worker
+		t.lease.Deadline = time.Now().Add(c.leaseTimeout)
+		c.leased[t.lease.ID] = t
+		return t.lease, true
+	}
+	return Lease{}, false
+}
+
+// Ack marks request leased by the worker as done.
+// It returns false if the worker does not hold the lease.
+func (c *Coordinator) Ack(worker, id string) bool {
+	defer c.Unlock()
+	c.Lock()
+	if t, ok := c.leased[id]; !ok || t.lease.Worker != worker {
+		return false
+	}
+	delete(c.leased, id)
+	c.stats.Acked++
+	return true
+}
+
+// Nack returns request leased by the worker to the frontier.
+// It returns false if the worker does not hold the lease.
+func (c *Coordinator) Nack(worker, id string) bool {
+	defer c.Unlock()
+	c.Lock()
+	t, ok := c.leased[id]
+	if !ok || t.lease.Worker != worker {
+		return false
+	}
+	delete(c.leased, id)
+	c.pending = append(c.pending, t)
+	return true
+}
+
+// Heartbeat extends leases held by the worker.
+func (c *Coordinator) Heartbeat(worker string, ids ...string) {
+	defer c.Unlock()
+	c.Lock()
+	for _, id := range ids {
+		if t, ok := c.leased[id]; ok && t.lease.Worker == worker {
+			t.lease.Deadline = time.Now().Add(c.leaseTimeout)
+		}
+	}
+}
+
+// Finish marks that no more requests are pushed, except of those
+// pushed by the workers while performing leased requests.
+func (c *Coordinator) Finish() {
+	defer c.Unlock()
+	c.Lock()
+	c.finished = true
+}
+
+// Done reports whether Coordinator is finished and its frontier is exhausted.
+func (c *Coordinator) Done() bool {
+	defer c.Unlock()
+	c.Lock()
+	c.expire()
+	return c.finished && len(c.pending) == 0 && len(c.leased) == 0
+}
+
+// Stats returns current Stats.
+func (c *Coordinator) Stats() Stats {
+	defer c.Unlock()
+	c.Lock()
+	c.expire()
+	stats := c.stats
+	stats.Pending = len(c.pending)
+	stats.Leased = len(c.leased)
+	return stats
+}
+
+// expire moves expired leases back to the frontier.
+func (c *Coordinator) expire() {
+	now := time.Now()
+	for id, t := range c.leased {
+		if now.After(t.lease.Deadline) {
+			delete(c.leased, id)
+			c.pending = append(c.pending, t)
+			c.stats.Expired++
+		}
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.URL.Path != PathStats {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var msg message
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	switch r.URL.Path {
+	case PathPush:
+		c.Push(msg.Requests...)
+		w.WriteHeader(http.StatusAccepted)
+	case PathLease:
+		lease, ok := c.Lease(msg.Worker)
+		if !ok {
+			writeFound(w, !c.Done())
+			return
+		}
+		writeJSON(w, lease)
+	case PathAck:
+		writeFound(w, c.Ack(msg.Worker, msg.ID))
+	case PathNack:
+		writeFound(w, c.Nack(msg.Worker, msg.ID))
+	case PathHeartbeat:
+		c.Heartbeat(msg.Worker, msg.IDs...)
+		w.WriteHeader(http.StatusNoContent)
+	case PathFinish:
+		c.Finish()
+		w.WriteHeader(http.StatusNoContent)
+	case PathStats:
+		writeJSON(w, c.Stats())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeFound(w http.ResponseWriter, found bool) {
+	if !found {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
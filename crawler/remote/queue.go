@@ -0,0 +1,229 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package remote
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bukowa/micro/crawler"
+)
+
+// Queue implements crawler.Queue backed by the Coordinator.
+// Pop leases requests from the Coordinator and Push adds them
+// to the Coordinator frontier, so they are shared with other workers.
+type Queue struct {
+	sync.Mutex
+
+	client    *Client
+	poll      time.Duration
+	heartbeat time.Duration
+
+	leases map[*http.Request]string
+	stop   chan struct{}
+	done   sync.WaitGroup
+	once   sync.Once
+}
+
+type QueueOption = func(q *Queue)
+
+// WithPoll sets time Queue waits before asking for a lease when frontier was empty.
+var WithPoll = func(t time.Duration) QueueOption {
+	return func(q *Queue) {
+		q.poll = t
+	}
+}
+
+// WithHeartbeat sets interval of sending heartbeats for held leases.
+var WithHeartbeat = func(t time.Duration) QueueOption {
+	return func(q *Queue) {
+		q.heartbeat = t
+	}
+}
+
+// NewQueue creates new Queue.
+func NewQueue(client *Client, opts ...QueueOption) *Queue {
+	q := &Queue{
+		client:    client,
+		poll:      time.Millisecond * 100,
+		heartbeat: time.Second * 10,
+		leases:    map[*http.Request]string{},
+		stop:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
+}
+
+// WithQueue sets Queue on the Crawler.
+// Queue starts sending heartbeats when Crawler starts and returns
+// held leases to the Coordinator once Crawler stopped.
+// Leases are acked when Crawler received a response and nacked on error.
+// Leases of dropped requests are acked, so they are not handed out again,
+// and leases of requests that panicked are nacked.
+var WithQueue = func(q *Queue) crawler.Option {
+	return func(c *crawler.Crawler) {
+		crawler.WithQueue(q)(c)
+		c.OnEvent(crawler.Start, func(e crawler.Event, c *crawler.Crawler) {
+			q.Start()
+		})
+		c.OnEvent(crawler.Stopped, func(e crawler.Event, c *crawler.Crawler) {
+			q.Close()
+		})
+		c.OnResponse(func(i int, c *crawler.Crawler, r crawler.Response) error {
+			q.Done(r.Request(), r.Error())
+			return nil
+		})
+		c.Subscribe(crawler.DropEvent, func(p crawler.Payload) {
+			q.Done(p.Request.Request(), nil)
+		})
+		c.Subscribe(crawler.PanicEvent, func(p crawler.Payload) {
+			q.Done(p.Request.Request(), p.Error)
+		})
+	}
+}
+
+// Push sends Request to the Coordinator.
+func (q *Queue) Push(ctx context.Context, r crawler.Request) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return q.TryPush(r)
+}
+
+// TryPush sends Request to the Coordinator, frontier of the Coordinator is never full.
+func (q *Queue) TryPush(r crawler.Request) error {
+	select {
+	case <-q.stop:
+		return crawler.ErrorQueueClosed
+	default:
+	}
+	return q.client.Push(r)
+}
+
+// Pop leases Request from the Coordinator, polling until ctx is done or Queue is closed.
+// It returns crawler.ErrorQueueClosed once the Coordinator finished.
+func (q *Queue) Pop(ctx context.Context) (crawler.Request, error) {
+	for {
+		select {
+		case <-q.stop:
+			return nil, crawler.ErrorQueueClosed
+		default:
+		}
+		lease, ok, err := q.client.Lease()
+		if err == ErrorFinished {
+			return nil, crawler.ErrorQueueClosed
+		}
+		if err == nil && ok {
+			request, err := lease.Request.Crawler()
+			if err != nil {
+				// request can never be performed
+				q.client.Ack(lease.ID)
+				continue
+			}
+			q.Lock()
+			q.leases[request.Request()] = lease.ID
+			q.Unlock()
+			return request, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		select {
+		case <-q.stop:
+		case <-ctx.Done():
+		case <-time.After(q.poll):
+		}
+	}
+}
+
+// Len returns count of pending requests of the Coordinator, or 0 if it's unavailable.
+func (q *Queue) Len() int {
+	stats, err := q.client.Stats()
+	if err != nil {
+		return 0
+	}
+	return stats.Pending
+}
+
+// Pending returns no requests, pending requests are kept by the Coordinator
+// and leased ones are returned to it once Queue is closed.
+func (q *Queue) Pending() ([]crawler.Request, error) {
+	return nil, nil
+}
+
+// Start starts sending heartbeats.
+func (q *Queue) Start() {
+	q.done.Add(1)
+	go q.beat()
+}
+
+// Close stops leasing requests and returns held leases to the Coordinator.
+func (q *Queue) Close() error {
+	q.once.Do(func() {
+		close(q.stop)
+		q.done.Wait()
+		for _, id := range q.held() {
+			q.client.Nack(id)
+		}
+	})
+	return nil
+}
+
+// Done acks lease of the request, or nacks it if err is not nil.
+// It does nothing for requests that were not leased.
+func (q *Queue) Done(r *http.Request, err error) error {
+	q.Lock()
+	id, ok := q.leases[r]
+	delete(q.leases, r)
+	q.Unlock()
+	if !ok {
+		return nil
+	}
+	if err != nil {
+		return q.client.Nack(id)
+	}
+	return q.client.Ack(id)
+}
+
+func (q *Queue) held() []string {
+	defer q.Unlock()
+	q.Lock()
+	var ids []string
+	for _, id := range q.leases {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (q *Queue) beat() {
+	defer q.done.Done()
+	ticker := time.NewTicker(q.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+			if ids := q.held(); len(ids) > 0 {
+				q.client.Heartbeat(ids...)
+			}
+		}
+	}
+}
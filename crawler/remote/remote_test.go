@@ -0,0 +1,221 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package remote_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bukowa/micro/crawler"
+	. "github.com/bukowa/micro/crawler/remote"
+)
+
+func TestDistributedCrawl(t *testing.T) {
+	var mu sync.Mutex
+	var served = map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		served[r.URL.Path]++
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	coordinator := NewCoordinator()
+	cs := httptest.NewServer(coordinator)
+	defer cs.Close()
+
+	var n = 30
+	var requests []crawler.Request
+	for i := 0; i < n; i++ {
+		r, _ := crawler.NewRequest("GET", fmt.Sprintf("%s/%d", ts.URL, i), nil)
+		requests = append(requests, r)
+	}
+	if err := NewClient(cs.URL, "seed").Push(requests...); err != nil {
+		t.Fatal(err)
+	}
+
+	var responses = crawler.NewCounter()
+	var workers []*crawler.Crawler
+	for i := 0; i < 3; i++ {
+		q := NewQueue(NewClient(cs.URL, fmt.Sprintf("worker-%d", i)), WithPoll(time.Millisecond*10))
+		c := crawler.NewCrawler(2, WithQueue(q), crawler.WithLoggerOutput(ioutil.Discard))
+		go func() {
+			for r := range c.Response() {
+				responses.Add(1)
+				r.Response().Body.Close()
+			}
+		}()
+		c.Start()
+		workers = append(workers, c)
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for responses.Size() < n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	for _, c := range workers {
+		c.Stop()
+		c.Wait()
+	}
+
+	if responses.Size() != n {
+		t.Errorf("want %v responses, got: %v", n, responses.Size())
+	}
+	if len(served) != n {
+		t.Errorf("want %v paths served, got: %v", n, len(served))
+	}
+	stats := coordinator.Stats()
+	if stats.Acked != n || stats.Pending != 0 || stats.Leased != 0 {
+		t.Errorf("invalid stats: %+v", stats)
+	}
+}
+
+func TestCoordinatorLeaseExpires(t *testing.T) {
+	coordinator := NewCoordinator(WithLeaseTimeout(time.Millisecond*50), WithMaxAttempts(2))
+	coordinator.Push(Request{Method: "GET", URL: "http://localhost"})
+
+	lease, ok := coordinator.Lease("crashed")
+	if !ok {
+		t.Fatal("no lease")
+	}
+	if _, ok := coordinator.Lease("other"); ok {
+		t.Error("leased request handed out twice")
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	lease2, ok := coordinator.Lease("other")
+	if !ok || lease2.Request.URL != lease.Request.URL {
+		t.Fatal("expired lease not handed out again")
+	}
+	// crashed worker cannot ack or nack lease that expired and belongs to other worker
+	if coordinator.Ack("crashed", lease.ID) || coordinator.Nack("crashed", lease.ID) {
+		t.Error("expired lease acked")
+	}
+	if coordinator.Ack("crashed", lease2.ID) || coordinator.Nack("crashed", lease2.ID) {
+		t.Error("lease of other worker acked")
+	}
+	if !coordinator.Ack("other", lease2.ID) {
+		t.Error("ack failed")
+	}
+
+	// nacked requests are dropped after max attempts
+	coordinator.Push(Request{Method: "GET", URL: "http://localhost"})
+	for i := 0; i < 2; i++ {
+		lease, ok := coordinator.Lease("worker")
+		if !ok {
+			t.Fatal("no lease")
+		}
+		coordinator.Nack("worker", lease.ID)
+	}
+	if _, ok := coordinator.Lease("worker"); ok {
+		t.Error("request not dropped")
+	}
+	if stats := coordinator.Stats(); stats.Dropped != 1 || stats.Expired != 1 {
+		t.Errorf("invalid stats: %+v", stats)
+	}
+}
+
+func TestQueueReleasesDropped(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	coordinator := NewCoordinator(WithMaxAttempts(1))
+	cs := httptest.NewServer(coordinator)
+	defer cs.Close()
+
+	for _, path := range []string{"/drop", "/panic"} {
+		r, _ := crawler.NewRequest("GET", ts.URL+path, nil)
+		if err := NewClient(cs.URL, "seed").Push(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q := NewQueue(NewClient(cs.URL, "worker"), WithPoll(time.Millisecond*10))
+	c := crawler.NewCrawler(1, WithQueue(q), crawler.WithLoggerOutput(ioutil.Discard))
+	c.OnRequest(func(i int, c *crawler.Crawler, r crawler.Request) error {
+		switch r.Request().URL.Path {
+		case "/drop":
+			return fmt.Errorf("dropped")
+		case "/panic":
+			panic("panic")
+		}
+		return nil
+	})
+	go func() {
+		for range c.Response() {
+		}
+	}()
+	c.Start()
+	defer c.Stop()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		if stats := coordinator.Stats(); stats.Acked == 1 && stats.Dropped == 1 && stats.Leased == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Errorf("leases not released: %+v", coordinator.Stats())
+}
+
+func TestQueueDepthAndFinish(t *testing.T) {
+	coordinator := NewCoordinator()
+	cs := httptest.NewServer(coordinator)
+	defer cs.Close()
+
+	r, err := crawler.SnapshotRequest{Method: "GET", URL: "http://localhost/a", Depth: 2}.Restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := NewClient(cs.URL, "seed")
+	if err := seed.Push(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := seed.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	q := NewQueue(NewClient(cs.URL, "worker"), WithPoll(time.Millisecond*10))
+	defer q.Close()
+	// snapshot of the worker does not lease pending requests
+	c := crawler.NewCrawler(1, WithQueue(q), crawler.WithLoggerOutput(ioutil.Discard))
+	if s, err := c.Snapshot(); err != nil || len(s.Pending) != 0 || coordinator.Stats().Leased != 0 {
+		t.Errorf("invalid snapshot: %+v %v %+v", s, err, coordinator.Stats())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	request, err := q.Pop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := crawler.RequestDepth(request); d != 2 {
+		t.Errorf("want depth 2, got: %v", d)
+	}
+	// frontier is not exhausted until leased request is done
+	if coordinator.Done() {
+		t.Error("coordinator done with leased request")
+	}
+	if err := q.Done(request.Request(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Pop(ctx); err != crawler.ErrorQueueClosed {
+		t.Errorf("want ErrorQueueClosed, got: %v", err)
+	}
+}
@@ -0,0 +1,518 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Report is a summary of the crawl.
+// End is a time of the last response, so idle time before crawlers
+// were stopped is not included, or current time while they are running.
+type Report struct {
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration"`
+
+	Requests  int `json:"requests"`
+	Responses int `json:"responses"`
+	Errors    int `json:"errors"`
+	// Bytes is a number of bytes read from response bodies.
+	Bytes int64 `json:"bytes"`
+	// Exhausted is a Budget that stopped the crawl.
+	Exhausted Budget `json:"exhausted,omitempty"`
+
+	// Throughput is a number of responses received in each interval of the crawl.
+	Throughput []Throughput `json:"throughput"`
+	// Status is a count of responses by status code.
+	Status map[int]int `json:"status"`
+	// ErrorClasses are counts of errors sorted from the most common.
+	ErrorClasses []ErrorClassCount `json:"error_classes"`
+	// Slowest are the slowest responses sorted from the slowest.
+	Slowest []SlowResponse `json:"slowest"`
+	Hosts   []HostReport   `json:"hosts"`
+	// Items is a count of extracted items by their name.
+	Items map[string]int `json:"items,omitempty"`
+}
+
+// Throughput is a number of responses received in the interval
+// starting at Offset from the start of the crawl.
+type Throughput struct {
+	Offset    time.Duration `json:"offset"`
+	Responses int           `json:"responses"`
+	Errors    int           `json:"errors"`
+}
+
+// ErrorClassCount is a number of errors of the ErrorClass.
+type ErrorClassCount struct {
+	Class ErrorClass `json:"class"`
+	Count int        `json:"count"`
+}
+
+// SlowResponse is a Response that took long time.
+type SlowResponse struct {
+	URL    string        `json:"url"`
+	Status int           `json:"status,omitempty"`
+	Took   time.Duration `json:"took"`
+}
+
+// HostReport summarises responses of a single host.
+type HostReport struct {
+	Host      string        `json:"host"`
+	Requests  int           `json:"requests"`
+	Responses int           `json:"responses"`
+	Errors    int           `json:"errors"`
+	Bytes     int64         `json:"bytes"`
+	Average   time.Duration `json:"average"`
+}
+
+// Reporter gathers Report of the crawl from events and Trackers of crawlers.
+// One Reporter can be used by many crawlers, for example members of a Group.
+type Reporter struct {
+	sync.Mutex
+
+	interval time.Duration
+	slowest  int
+
+	crawlers   []*Crawler
+	start      time.Time
+	end        time.Time
+	stop       time.Time
+	running    int
+	bytes      int64
+	exhausted  Budget
+	throughput map[int]*Throughput
+	status     map[int]int
+	classes    map[ErrorClass]int
+	slow       []SlowResponse
+	hosts      map[string]*hostReport
+	items      map[string]int
+}
+
+type hostReport struct {
+	HostReport
+	took time.Duration
+}
+
+// NewReporter creates new Reporter measuring throughput in intervals
+// and keeping n slowest responses.
+func NewReporter(interval time.Duration, n int) *Reporter {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &Reporter{
+		interval:   interval,
+		slowest:    n,
+		throughput: map[int]*Throughput{},
+		status:     map[int]int{},
+		classes:    map[ErrorClass]int{},
+		hosts:      map[string]*hostReport{},
+		items:      map[string]int{},
+	}
+}
+
+// WithReport gathers Report of the crawl with Reporter.
+var WithReport = func(r *Reporter) Option {
+	return func(c *Crawler) {
+		r.Lock()
+		r.crawlers = append(r.crawlers, c)
+		r.Unlock()
+		c.Subscribe(Started, r.started)
+		c.Subscribe(Stopped, r.stopped)
+		c.Subscribe(RequestEvent, r.request)
+		c.Subscribe(ResponseEvent, r.response)
+		c.Subscribe(ErrorEvent, r.error)
+		c.Subscribe(PanicEvent, r.panicked)
+		c.Subscribe(BudgetExhausted, r.budget)
+		c.OnResponse(func(i int, c *Crawler, res Response) error {
+			if h := res.Response(); h != nil && h.Body != nil {
+				h.Body = &reportReader{ReadCloser: h.Body, reporter: r, host: res.Request().URL.Host}
+			}
+			return nil
+		})
+	}
+}
+
+// AddItems adds n items with the name extracted from responses.
+func (r *Reporter) AddItems(name string, n int) {
+	defer r.Unlock()
+	r.Lock()
+	r.items[name] += n
+}
+
+func (r *Reporter) started(p Payload) {
+	defer r.Unlock()
+	r.Lock()
+	if r.start.IsZero() {
+		r.start = p.Time
+	}
+	r.running++
+}
+
+func (r *Reporter) stopped(p Payload) {
+	defer r.Unlock()
+	r.Lock()
+	r.running--
+	r.stop = p.Time
+}
+
+func (r *Reporter) budget(p Payload) {
+	defer r.Unlock()
+	r.Lock()
+	if b, ok := p.Value.(Budget); ok && r.exhausted == "" {
+		r.exhausted = b
+	}
+}
+
+func (r *Reporter) request(p Payload) {
+	defer r.Unlock()
+	r.Lock()
+	r.host(p.Request.Request().URL.Host).Requests++
+}
+
+func (r *Reporter) response(p Payload) {
+	res := p.Response
+	var status int
+	if h := res.Response(); h != nil {
+		status = h.StatusCode
+	}
+
+	defer r.Unlock()
+	r.Lock()
+	if p.Time.After(r.end) {
+		r.end = p.Time
+	}
+	t := r.bucket(p.Time)
+	t.Responses++
+	h := r.host(res.Request().URL.Host)
+	h.Responses++
+	h.took += res.Time()
+	if p.Error != nil {
+		t.Errors++
+		h.Errors++
+	} else {
+		r.status[status]++
+	}
+
+	if r.slowest <= 0 {
+		return
+	}
+	slow := SlowResponse{URL: res.Request().URL.String(), Status: status, Took: res.Time()}
+	i := sort.Search(len(r.slow), func(i int) bool {
+		return r.slow[i].Took < slow.Took
+	})
+	if i >= r.slowest {
+		return
+	}
+	r.slow = append(r.slow, SlowResponse{})
+	copy(r.slow[i+1:], r.slow[i:])
+	r.slow[i] = slow
+	if len(r.slow) > r.slowest {
+		r.slow = r.slow[:r.slowest]
+	}
+}
+
+// error counts ErrorClass of failed requests and errors of reading response bodies.
+func (r *Reporter) error(p Payload) {
+	defer r.Unlock()
+	r.Lock()
+	if class, ok := p.Value.(ErrorClass); ok {
+		r.classes[class]++
+	}
+}
+
+// panicked counts Response of the recovered panic, which has no ResponseEvent,
+// unless Response of the Request was counted before the panic.
+func (r *Reporter) panicked(p Payload) {
+	var e *ErrorPanic
+	if errors.As(p.Error, &e) && e.Responded {
+		return
+	}
+	defer r.Unlock()
+	r.Lock()
+	if p.Time.After(r.end) {
+		r.end = p.Time
+	}
+	t := r.bucket(p.Time)
+	t.Responses++
+	t.Errors++
+	h := r.host(p.Request.Request().URL.Host)
+	h.Responses++
+	h.Errors++
+	r.classes[ClassPanic]++
+}
+
+// bucket returns Throughput of the interval of time t.
+func (r *Reporter) bucket(t time.Time) *Throughput {
+	var i int
+	if !r.start.IsZero() && t.After(r.start) {
+		i = int(t.Sub(r.start) / r.interval)
+	}
+	b, ok := r.throughput[i]
+	if !ok {
+		b = &Throughput{Offset: time.Duration(i) * r.interval}
+		r.throughput[i] = b
+	}
+	return b
+}
+
+func (r *Reporter) host(host string) *hostReport {
+	h, ok := r.hosts[host]
+	if !ok {
+		h = &hostReport{HostReport: HostReport{Host: host}}
+		r.hosts[host] = h
+	}
+	return h
+}
+
+func (r *Reporter) read(host string, n int) {
+	defer r.Unlock()
+	r.Lock()
+	r.bytes += int64(n)
+	r.host(host).Bytes += int64(n)
+}
+
+// Report returns Report of the crawl so far.
+// Totals are summed from Trackers of crawlers.
+func (r *Reporter) Report() Report {
+	defer r.Unlock()
+	r.Lock()
+	report := Report{
+		Start:     r.start,
+		End:       r.end,
+		Bytes:     r.bytes,
+		Exhausted: r.exhausted,
+		Status:    map[int]int{},
+		Items:     map[string]int{},
+	}
+	if report.End.IsZero() {
+		report.End = r.stop
+	}
+	if r.running > 0 || report.End.Before(report.Start) {
+		report.End = time.Now()
+	}
+	if !report.Start.IsZero() {
+		report.Duration = report.End.Sub(report.Start)
+	}
+	for _, c := range r.crawlers {
+		report.Requests += c.Requests().Size()
+		report.Responses += c.Responses().Size()
+		report.Errors += c.Errors().Size()
+	}
+
+	// intervals without responses are reported too
+	var last = -1
+	for i := range r.throughput {
+		if i > last {
+			last = i
+		}
+	}
+	for i := 0; i <= last; i++ {
+		t := Throughput{Offset: time.Duration(i) * r.interval}
+		if b, ok := r.throughput[i]; ok {
+			t = *b
+		}
+		report.Throughput = append(report.Throughput, t)
+	}
+
+	for status, n := range r.status {
+		report.Status[status] = n
+	}
+	for class, n := range r.classes {
+		report.ErrorClasses = append(report.ErrorClasses, ErrorClassCount{Class: class, Count: n})
+	}
+	sort.Slice(report.ErrorClasses, func(i, j int) bool {
+		a, b := report.ErrorClasses[i], report.ErrorClasses[j]
+		return a.Count > b.Count || (a.Count == b.Count && a.Class < b.Class)
+	})
+	report.Slowest = append([]SlowResponse(nil), r.slow...)
+	for _, h := range r.hosts {
+		host := h.HostReport
+		if host.Responses > 0 {
+			host.Average = h.took / time.Duration(host.Responses)
+		}
+		report.Hosts = append(report.Hosts, host)
+	}
+	sort.Slice(report.Hosts, func(i, j int) bool {
+		a, b := report.Hosts[i], report.Hosts[j]
+		return a.Requests > b.Requests || (a.Requests == b.Requests && a.Host < b.Host)
+	})
+	for name, n := range r.items {
+		report.Items[name] = n
+	}
+	return report
+}
+
+// RequestsPerSecond returns average number of responses received per second.
+func (r Report) RequestsPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Responses) / r.Duration.Seconds()
+}
+
+// WriteJSON writes indented json encoded Report.
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteHTML writes Report as a standalone html document.
+func (r Report) WriteHTML(w io.Writer) error {
+	var statuses []int
+	for status := range r.Status {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	var items []string
+	for name := range r.Items {
+		items = append(items, name)
+	}
+	sort.Strings(items)
+	var max = 1
+	for _, t := range r.Throughput {
+		if t.Responses > max {
+			max = t.Responses
+		}
+	}
+	return reportTemplate.Execute(w, struct {
+		Report
+		Statuses  []int
+		ItemNames []string
+		Max       int
+	}{r, statuses, items, max})
+}
+
+// reportReader counts bytes read from response body.
+type reportReader struct {
+	io.ReadCloser
+	reporter *Reporter
+	host     string
+}
+
+func (r *reportReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.reporter.read(r.host, n)
+	return n, err
+}
+
+var reportTemplate = htmltemplate.Must(htmltemplate.New("report").Funcs(htmltemplate.FuncMap{
+	"ms": func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	},
+	"height": func(n, max int) int {
+		return n * 100 / max
+	},
+	"x": func(i int) int {
+		return i * 6
+	},
+	"y": func(n, max int) int {
+		return 100 - n*100/max
+	},
+	"width": func(n int) int {
+		return n*6 + 1
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Crawl report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+td.n { text-align: right; }
+svg rect.r { fill: #4a7ebb; }
+svg rect.e { fill: #c0392b; }
+</style>
+</head>
+<body>
+<h1>Crawl report</h1>
+<table>
+<tr><th>Start</th><td>{{.Start.Format "2006-01-02 15:04:05"}}</td></tr>
+<tr><th>End</th><td>{{.End.Format "2006-01-02 15:04:05"}}</td></tr>
+<tr><th>Duration</th><td>{{ms .Duration}}</td></tr>
+<tr><th>Requests</th><td class="n">{{.Requests}}</td></tr>
+<tr><th>Responses</th><td class="n">{{.Responses}}</td></tr>
+<tr><th>Errors</th><td class="n">{{.Errors}}</td></tr>
+<tr><th>Responses per second</th><td class="n">{{printf "%.2f" .RequestsPerSecond}}</td></tr>
+<tr><th>Bytes</th><td class="n">{{.Bytes}}</td></tr>
+{{- if .Exhausted}}
+<tr><th>Exhausted budget</th><td>{{.Exhausted}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Throughput</h2>
+<svg width="{{width (len .Throughput)}}" height="100" viewBox="0 0 {{width (len .Throughput)}} 100">
+{{- range $i, $t := .Throughput}}
+<rect class="r" x="{{x $i}}" y="{{y $t.Responses $.Max}}" width="5" height="{{height $t.Responses $.Max}}"><title>{{ms $t.Offset}}: {{$t.Responses}} responses, {{$t.Errors}} errors</title></rect>
+{{- if $t.Errors}}
+<rect class="e" x="{{x $i}}" y="{{y $t.Errors $.Max}}" width="5" height="{{height $t.Errors $.Max}}"></rect>
+{{- end}}
+{{- end}}
+</svg>
+
+<h2>Status codes</h2>
+<table>
+<tr><th>Status</th><th>Responses</th></tr>
+{{- range .Statuses}}
+<tr><td>{{.}}</td><td class="n">{{index $.Status .}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Errors</h2>
+<table>
+<tr><th>Class</th><th>Errors</th></tr>
+{{- range .ErrorClasses}}
+<tr><td>{{.Class}}</td><td class="n">{{.Count}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Slowest responses</h2>
+<table>
+<tr><th>URL</th><th>Status</th><th>Took</th></tr>
+{{- range .Slowest}}
+<tr><td>{{.URL}}</td><td>{{if .Status}}{{.Status}}{{end}}</td><td class="n">{{ms .Took}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Hosts</h2>
+<table>
+<tr><th>Host</th><th>Requests</th><th>Responses</th><th>Errors</th><th>Bytes</th><th>Average</th></tr>
+{{- range .Hosts}}
+<tr><td>{{.Host}}</td><td class="n">{{.Requests}}</td><td class="n">{{.Responses}}</td><td class="n">{{.Errors}}</td><td class="n">{{.Bytes}}</td><td class="n">{{ms .Average}}</td></tr>
+{{- end}}
+</table>
+{{- if .ItemNames}}
+
+<h2>Items</h2>
+<table>
+<tr><th>Name</th><th>Items</th></tr>
+{{- range .ItemNames}}
+<tr><td>{{.}}</td><td class="n">{{index $.Items .}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
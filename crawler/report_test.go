@@ -0,0 +1,167 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestReport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(time.Millisecond * 50)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte("0123456789"))
+	}))
+	defer ts.Close()
+
+	reporter := NewReporter(time.Millisecond*10, 2)
+	c := NewCrawler(2, WithQueue(NewBufferedQueue(10)), WithReport(reporter), WithLoggerOutput(ioutil.Discard))
+	for _, u := range []string{ts.URL + "/", ts.URL + "/slow", ts.URL + "/missing", "http://127.0.0.1:1/"} {
+		r, _ := NewRequest("GET", u, nil)
+		c.Push(context.Background(), r)
+	}
+	c.Start()
+	for i := 0; i < 4; i++ {
+		r := <-c.Response()
+		if res := r.Response(); res != nil {
+			ioutil.ReadAll(res.Body)
+			res.Body.Close()
+		}
+	}
+	reporter.AddItems("links", 3)
+	// idle time before stop is not reported
+	last := time.Now()
+	time.Sleep(time.Millisecond * 50)
+	c.Stop()
+
+	report := reporter.Report()
+	if report.Requests != 4 || report.Responses != 4 || report.Errors != 1 {
+		t.Errorf("unexpected totals: %+v", report)
+	}
+	if report.Duration <= 0 || report.End.Before(report.Start) || report.End.After(last) {
+		t.Errorf("unexpected duration %s", report.Duration)
+	}
+	if report.Bytes != 30 {
+		t.Errorf("want 30 bytes, got: %d", report.Bytes)
+	}
+	if report.Status[200] != 2 || report.Status[404] != 1 {
+		t.Errorf("unexpected status: %v", report.Status)
+	}
+	if len(report.ErrorClasses) != 1 || report.ErrorClasses[0] != (ErrorClassCount{Class: ClassConnectionRefused, Count: 1}) {
+		t.Errorf("unexpected error classes: %v", report.ErrorClasses)
+	}
+	if len(report.Slowest) != 2 || !strings.HasSuffix(report.Slowest[0].URL, "/slow") || report.Slowest[0].Took < report.Slowest[1].Took {
+		t.Errorf("unexpected slowest: %v", report.Slowest)
+	}
+	if len(report.Hosts) != 2 || report.Hosts[0].Requests != 3 || report.Hosts[0].Bytes != 30 || report.Hosts[1].Errors != 1 {
+		t.Errorf("unexpected hosts: %+v", report.Hosts)
+	}
+	if report.Items["links"] != 3 {
+		t.Errorf("unexpected items: %v", report.Items)
+	}
+	var responses int
+	for i, tp := range report.Throughput {
+		if tp.Offset != time.Duration(i)*time.Millisecond*10 {
+			t.Errorf("unexpected offset %s of interval %d", tp.Offset, i)
+		}
+		responses += tp.Responses
+	}
+	if responses != 4 {
+		t.Errorf("want 4 responses in throughput, got: %d", responses)
+	}
+
+	var b bytes.Buffer
+	if err := report.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(b.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Responses != 4 || decoded.Status[404] != 1 || len(decoded.Hosts) != 2 {
+		t.Errorf("unexpected decoded report: %+v", decoded)
+	}
+
+	b.Reset()
+	if err := report.WriteHTML(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<!DOCTYPE html>", "<td>404</td>", string(ClassConnectionRefused), ts.URL + "/slow", "<td>links</td>", "<svg"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("html report does not contain %q", want)
+		}
+	}
+}
+
+func TestReportPanic(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	reporter := NewReporter(time.Second, 2)
+	c := NewCrawler(1, WithQueue(NewBufferedQueue(10)), WithReport(reporter), WithLoggerOutput(ioutil.Discard))
+	c.OnRequest(func(i int, c *Crawler, r Request) error {
+		if r.Request().URL.Path == "/panic" {
+			panic("request")
+		}
+		return nil
+	})
+	for _, path := range []string{"/", "/panic"} {
+		r, _ := NewRequest("GET", ts.URL+path, nil)
+		c.Push(context.Background(), r)
+	}
+	c.Start()
+	for i := 0; i < 2; i++ {
+		if res := (<-c.Response()).Response(); res != nil {
+			res.Body.Close()
+		}
+	}
+	c.Stop()
+
+	report := reporter.Report()
+	if report.Responses != 2 || report.Errors != 1 {
+		t.Errorf("unexpected totals: %+v", report)
+	}
+	if len(report.ErrorClasses) != 1 || report.ErrorClasses[0] != (ErrorClassCount{Class: ClassPanic, Count: 1}) {
+		t.Errorf("unexpected error classes: %v", report.ErrorClasses)
+	}
+	if len(report.Throughput) != 1 || report.Throughput[0].Responses != 2 || report.Throughput[0].Errors != 1 {
+		t.Errorf("unexpected throughput: %v", report.Throughput)
+	}
+}
+
+func TestReportEmpty(t *testing.T) {
+	report := NewReporter(0, 0).Report()
+	if report.Duration != 0 || len(report.Throughput) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if err := report.WriteHTML(ioutil.Discard); err != nil {
+		t.Error(err)
+	}
+}
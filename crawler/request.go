@@ -50,12 +50,41 @@ func NewRequestWithContext(ctx context.Context, method, url string, body io.Read
 	return r, nil
 }
 
+// NewChildRequest wraps http.NewRequest and sets depth
+// of the new Request to depth of the parent increased by 1.
+func NewChildRequest(parent Request, method, url string, body io.Reader) (Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	r := &BaseRequest{
+		request: req,
+		depth:   RequestDepth(parent) + 1,
+	}
+	return r, nil
+}
+
+// RequestDepth returns depth of the Request.
+// Requests that do not implement Depth() are of depth 0.
+func RequestDepth(r Request) int {
+	if d, ok := r.(interface{ Depth() int }); ok {
+		return d.Depth()
+	}
+	return 0
+}
+
 // BaseRequest implements Request.
 type BaseRequest struct {
 	request *http.Request
+	depth   int
 }
 
 // Request returns http.Request instance.
 func (r *BaseRequest) Request() *http.Request {
 	return r.request
 }
+
+// Depth returns number of requests that led to this Request.
+func (r *BaseRequest) Depth() int {
+	return r.depth
+}
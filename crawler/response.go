@@ -45,6 +45,8 @@ type BaseResponse struct {
 	xresponse *http.Response
 	error     error
 	took      time.Duration
+	trace     *trace
+	path      string
 }
 
 // Time returns time it took to complete request.
@@ -62,7 +64,59 @@ func (r *BaseResponse) Response() *http.Response {
 	return r.xresponse
 }
 
-// Error returns error as received from http.Client.
+// Depth returns depth of the underlying Request,
+// so children of the Response can be created with NewChildRequest.
+func (r *BaseResponse) Depth() int {
+	return RequestDepth(r.xrequest)
+}
+
+// Error returns error as received from http.Client or error of the Downloader.
 func (r *BaseResponse) Error() error {
 	return r.error
 }
+
+// Timing returns network timing breakdown of the request.
+func (r *BaseResponse) Timing() Timing {
+	if r.trace == nil {
+		return Timing{}
+	}
+	return r.trace.Timing()
+}
+
+// Redirects returns redirects taken by the request.
+func (r *BaseResponse) Redirects() []Redirect {
+	if r.trace == nil {
+		return nil
+	}
+	return r.trace.Redirects()
+}
+
+// TLS returns TLS connection summary of the response.
+func (r *BaseResponse) TLS() *TLS {
+	if r.xresponse == nil {
+		return nil
+	}
+	return NewTLS(r.xresponse.TLS)
+}
+
+// ErrorClass returns ErrorClass of the error, phase of timeouts is taken from Timing.
+func (r *BaseResponse) ErrorClass() ErrorClass {
+	return classify(r.error, r.trace)
+}
+
+func (r *BaseResponse) setTrace(t *trace) {
+	r.trace = t
+}
+
+// Path returns path of the file body was stored in by the Downloader.
+func (r *BaseResponse) Path() string {
+	return r.path
+}
+
+func (r *BaseResponse) setPath(path string) {
+	r.path = path
+}
+
+func (r *BaseResponse) setError(err error) {
+	r.error = err
+}
@@ -0,0 +1,100 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrorSeen is returned by OnRequest function registered
+// with WithSeen when Request was already crawled.
+var ErrorSeen = errors.New("request already seen")
+
+// Seen is a set of keys of requests that were already crawled.
+// It has to be safe to use by multiple goroutines.
+type Seen interface {
+	// Add adds key to the set and reports whether it was not present before.
+	Add(key string) bool
+	Has(key string) bool
+	Keys() []string
+}
+
+// RequestKey returns key identifying Request in Seen.
+// Set it to CanonicalKey to identify requests by their canonical url,
+// or use WithRequestKey to set it only for one Crawler.
+var RequestKey = func(r Request) string {
+	return r.Request().Method + " " + r.Request().URL.String()
+}
+
+// WithRequestKey sets function identifying requests of the Crawler
+// in Seen and Downloader, it's used instead of RequestKey.
+var WithRequestKey = func(f func(r Request) string) Option {
+	return func(c *Crawler) {
+		c.requestKey = f
+	}
+}
+
+// RequestKey returns key identifying Request, set with WithRequestKey or RequestKey.
+func (c *Crawler) RequestKey(r Request) string {
+	if c.requestKey != nil {
+		return c.requestKey(r)
+	}
+	return RequestKey(r)
+}
+
+// NewSeen creates new Seen.
+func NewSeen() Seen {
+	return &BaseSeen{
+		keys: map[string]struct{}{},
+	}
+}
+
+// BaseSeen implements Seen.
+type BaseSeen struct {
+	sync.RWMutex
+	keys map[string]struct{}
+}
+
+// Add adds key to the set and reports whether it was not present before.
+func (s *BaseSeen) Add(key string) bool {
+	defer s.Unlock()
+	s.Lock()
+	if _, ok := s.keys[key]; ok {
+		return false
+	}
+	s.keys[key] = struct{}{}
+	return true
+}
+
+// Has reports whether key is in the set.
+func (s *BaseSeen) Has(key string) bool {
+	defer s.RUnlock()
+	s.RLock()
+	_, ok := s.keys[key]
+	return ok
+}
+
+// Keys returns all keys in the set.
+func (s *BaseSeen) Keys() []string {
+	defer s.RUnlock()
+	s.RLock()
+	keys := make([]string, 0, len(s.keys))
+	for k := range s.keys {
+		keys = append(keys, k)
+	}
+	return keys
+}
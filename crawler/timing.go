@@ -0,0 +1,195 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing is a network timing breakdown of a Response.
+// Durations of phases that did not happen, for example DNS lookup
+// and connect when connection was reused, are 0.
+type Timing struct {
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	// FirstByte is time from writing Request to the connection
+	// to receiving first byte of Response.
+	FirstByte time.Duration
+	// Transfer is time from receiving Response headers until body was read or closed.
+	Transfer   time.Duration
+	Reused     bool
+	RemoteAddr string
+}
+
+// ResponseTiming returns Timing of the Response.
+// Responses that do not implement Timing() have empty Timing.
+func ResponseTiming(r Response) Timing {
+	if t, ok := r.(interface{ Timing() Timing }); ok {
+		return t.Timing()
+	}
+	return Timing{}
+}
+
+// timed is implemented by responses that can hold trace.
+type timed interface {
+	setTrace(t *trace)
+}
+
+// trace collects Timing and redirects of a single Request.
+// It has to be safe to use by multiple goroutines, because body
+// can be read by different goroutine than the one sending Request.
+type trace struct {
+	sync.Mutex
+	parent    Request
+	timing    Timing
+	redirects []Redirect
+
+	wrote     time.Time
+	dns       time.Time
+	connect   time.Time
+	handshake time.Time
+	headers   time.Time
+}
+
+type traceKey struct{}
+
+func newTrace(parent Request) *trace {
+	return &trace{parent: parent}
+}
+
+// traceFrom returns trace attached to the context.
+func traceFrom(ctx context.Context) *trace {
+	t, _ := ctx.Value(traceKey{}).(*trace)
+	return t
+}
+
+// request returns http.Request with trace attached to its context.
+func (t *trace) request(req *http.Request) *http.Request {
+	ctx := context.WithValue(req.Context(), traceKey{}, t)
+	return req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.set(&t.dns)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.since(&t.timing.DNS, &t.dns)
+		},
+		ConnectStart: func(network, addr string) {
+			t.set(&t.connect)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.since(&t.timing.Connect, &t.connect)
+		},
+		TLSHandshakeStart: func() {
+			t.set(&t.handshake)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.since(&t.timing.TLSHandshake, &t.handshake)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			defer t.Unlock()
+			t.Lock()
+			t.timing.Reused = info.Reused
+			if info.Conn != nil {
+				t.timing.RemoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.set(&t.wrote)
+		},
+		GotFirstResponseByte: func() {
+			defer t.Unlock()
+			t.Lock()
+			// server can respond before Request was written
+			if !t.wrote.IsZero() {
+				t.timing.FirstByte = time.Since(t.wrote)
+			}
+		},
+	}))
+}
+
+// body measures transfer time of the response body.
+func (t *trace) body(res *http.Response) {
+	if res == nil || res.Body == nil {
+		return
+	}
+	t.set(&t.headers)
+	res.Body = &traceBody{ReadCloser: res.Body, trace: t}
+}
+
+func (t *trace) Timing() Timing {
+	defer t.Unlock()
+	t.Lock()
+	return t.timing
+}
+
+func (t *trace) Redirects() []Redirect {
+	defer t.Unlock()
+	t.Lock()
+	redirects := make([]Redirect, len(t.redirects))
+	copy(redirects, t.redirects)
+	return redirects
+}
+
+func (t *trace) redirect(r Redirect) {
+	defer t.Unlock()
+	t.Lock()
+	t.redirects = append(t.redirects, r)
+}
+
+func (t *trace) set(v *time.Time) {
+	defer t.Unlock()
+	t.Lock()
+	*v = time.Now()
+}
+
+func (t *trace) since(v *time.Duration, start *time.Time) {
+	defer t.Unlock()
+	t.Lock()
+	*v = time.Since(*start)
+}
+
+// traceBody records Transfer once body was read or closed.
+type traceBody struct {
+	io.ReadCloser
+	trace *trace
+	once  sync.Once
+}
+
+func (b *traceBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *traceBody) Close() error {
+	b.done()
+	return b.ReadCloser.Close()
+}
+
+func (b *traceBody) done() {
+	b.once.Do(func() {
+		b.trace.since(&b.trace.timing.Transfer, &b.trace.headers)
+	})
+}
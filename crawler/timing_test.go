@@ -0,0 +1,79 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+func TestResponseTiming(t *testing.T) {
+	var transfer = time.Millisecond * 50
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		time.Sleep(transfer)
+		w.Write([]byte("second"))
+	}))
+	defer ts.Close()
+
+	c := NewCrawler(1, WithClient(ts.Client()), WithLoggerOutput(ioutil.Discard))
+	c.Start()
+	defer c.Wait()
+	defer c.Stop()
+
+	for i := 0; i < 2; i++ {
+		r, _ := NewRequest("GET", ts.URL, nil)
+		c.Push(context.Background(), r)
+		res := <-c.Response()
+		if res.Error() != nil {
+			t.Fatal(res.Error())
+		}
+		ioutil.ReadAll(res.Response().Body)
+		res.Response().Body.Close()
+
+		timing := ResponseTiming(res)
+		if timing.RemoteAddr != ts.Listener.Addr().String() {
+			t.Errorf("invalid remote addr: %s", timing.RemoteAddr)
+		}
+		if timing.FirstByte <= 0 || timing.FirstByte > res.Time() {
+			t.Errorf("invalid first byte: %s", timing.FirstByte)
+		}
+		if timing.Transfer < transfer {
+			t.Errorf("invalid transfer: %s", timing.Transfer)
+		}
+		// second request reuses connection
+		if reused := i == 1; timing.Reused != reused {
+			t.Errorf("want reused: %v, got: %v", reused, timing.Reused)
+		}
+		if i == 0 && (timing.Connect <= 0 || timing.TLSHandshake <= 0) {
+			t.Errorf("connect and handshake not measured: %+v", timing)
+		}
+		// first byte is measured once Request was written
+		if timing.Connect+timing.TLSHandshake+timing.FirstByte > res.Time() {
+			t.Errorf("first byte measured before request was written: %+v", timing)
+		}
+		if i == 1 && (timing.Connect != 0 || timing.TLSHandshake != 0) {
+			t.Errorf("reused connection measured: %+v", timing)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// TLS is a summary of the TLS connection of a Response.
+type TLS struct {
+	// Version is a name of negotiated TLS version, like "TLS 1.3".
+	Version            string `json:"version"`
+	CipherSuite        string `json:"cipher_suite"`
+	NegotiatedProtocol string `json:"negotiated_protocol,omitempty"`
+	ServerName         string `json:"server_name,omitempty"`
+	// Certificates are peer certificates, leaf first.
+	Certificates []Certificate `json:"certificates"`
+	// Chain is the raw peer certificate chain, leaf first.
+	Chain []*x509.Certificate `json:"-"`
+}
+
+// Certificate is a summary of a x509 certificate.
+type Certificate struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	DNSNames     []string  `json:"dns_names,omitempty"`
+	SerialNumber string    `json:"serial_number"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	// SHA256 is a hex encoded fingerprint of the certificate.
+	SHA256 string `json:"sha256"`
+}
+
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// NewTLS creates TLS from connection state.
+func NewTLS(cs *tls.ConnectionState) *TLS {
+	if cs == nil {
+		return nil
+	}
+	t := &TLS{
+		Version:            tlsVersions[cs.Version],
+		CipherSuite:        tls.CipherSuiteName(cs.CipherSuite),
+		NegotiatedProtocol: cs.NegotiatedProtocol,
+		ServerName:         cs.ServerName,
+		Chain:              cs.PeerCertificates,
+	}
+	if t.Version == "" {
+		t.Version = fmt.Sprintf("0x%04X", cs.Version)
+	}
+	for _, cert := range cs.PeerCertificates {
+		sum := sha256.Sum256(cert.Raw)
+		t.Certificates = append(t.Certificates, Certificate{
+			Subject:      cert.Subject.String(),
+			Issuer:       cert.Issuer.String(),
+			DNSNames:     cert.DNSNames,
+			SerialNumber: cert.SerialNumber.String(),
+			NotBefore:    cert.NotBefore,
+			NotAfter:     cert.NotAfter,
+			SHA256:       hex.EncodeToString(sum[:]),
+		})
+	}
+	return t
+}
+
+// ResponseTLS returns TLS of the Response.
+// Responses that do not implement TLS() or were not sent over TLS have nil TLS.
+func ResponseTLS(r Response) *TLS {
+	if t, ok := r.(interface{ TLS() *TLS }); ok {
+		return t.TLS()
+	}
+	if res := r.Response(); res != nil {
+		return NewTLS(res.TLS)
+	}
+	return nil
+}
+
+// LoadCertPool returns system certificate pool with PEM certificates from files appended.
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in %s", file)
+		}
+	}
+	return pool, nil
+}
+
+// ErrorTLSTransport is returned for requests of the Crawler with TLS options
+// when its client transport is not a *http.Transport, as the options cannot be applied.
+type ErrorTLSTransport string
+
+func (e ErrorTLSTransport) Error() string {
+	return "tls options require *http.Transport, got " + string(e)
+}
+
+// errorTransport fails every request with err.
+type errorTransport struct {
+	err error
+}
+
+func (t errorTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Body != nil {
+		r.Body.Close()
+	}
+	return nil, t.err
+}
+
+// tlsSettings are TLS options of the Crawler.
+// TLS options modify a copy of the client *http.Transport,
+// they are applied once all options were passed, so also after WithClient.
+type tlsSettings struct {
+	transport   *http.Transport
+	insecure    map[string]bool
+	serverNames map[string]string
+	options     []func(s *tlsSettings, config *tls.Config)
+}
+
+// WithTLSConfig modifies tls.Config of the client transport.
+var WithTLSConfig = func(f func(config *tls.Config)) Option {
+	return withTLS(func(s *tlsSettings, config *tls.Config) {
+		f(config)
+	})
+}
+
+// WithClientCertificate sets certificates presented to servers requesting client authentication.
+var WithClientCertificate = func(certs ...tls.Certificate) Option {
+	return WithTLSConfig(func(config *tls.Config) {
+		config.Certificates = append(config.Certificates, certs...)
+	})
+}
+
+// WithRootCAs sets certificate authorities used to verify servers, see LoadCertPool.
+var WithRootCAs = func(pool *x509.CertPool) Option {
+	return WithTLSConfig(func(config *tls.Config) {
+		config.RootCAs = pool
+	})
+}
+
+// WithMinTLSVersion sets minimum TLS version, like tls.VersionTLS12.
+var WithMinTLSVersion = func(version uint16) Option {
+	return WithTLSConfig(func(config *tls.Config) {
+		config.MinVersion = version
+	})
+}
+
+// WithInsecureHosts skips verification of certificates of given hosts.
+// Certificates of other hosts are verified.
+var WithInsecureHosts = func(hosts ...string) Option {
+	return withTLS(func(s *tlsSettings, config *tls.Config) {
+		for _, host := range hosts {
+			s.insecure[host] = true
+		}
+		s.transport.DialTLSContext = s.dialTLS
+	})
+}
+
+// WithServerName sends serverName in TLS handshake with the host instead of the host name.
+// Certificate of the host is verified against serverName.
+var WithServerName = func(host, serverName string) Option {
+	return withTLS(func(s *tlsSettings, config *tls.Config) {
+		s.serverNames[host] = serverName
+		s.transport.DialTLSContext = s.dialTLS
+	})
+}
+
+func withTLS(f func(s *tlsSettings, config *tls.Config)) Option {
+	return func(c *Crawler) {
+		if c.tls == nil {
+			c.tls = &tlsSettings{insecure: map[string]bool{}, serverNames: map[string]string{}}
+		}
+		c.tls.options = append(c.tls.options, f)
+	}
+}
+
+// applyTLS applies TLS options to a copy of the client transport.
+func (c *Crawler) applyTLS() {
+	if c.tls == nil {
+		return
+	}
+	rt := c.client.Transport
+	router, _ := rt.(*fileRouter)
+	if router != nil {
+		rt = router.next
+	}
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	client := *c.client
+	c.client = &client
+	var setTransport = func(rt http.RoundTripper) {
+		if router != nil {
+			r := *router
+			r.next = rt
+			client.Transport = &r
+		} else {
+			client.Transport = rt
+		}
+	}
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		// requests are not sent without the settings
+		err := ErrorTLSTransport(fmt.Sprintf("%T", rt))
+		c.Print(err)
+		setTransport(errorTransport{err: err})
+		return
+	}
+	// copy, so shared transports like http.DefaultTransport are not modified
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	c.tls.transport = t
+	setTransport(t)
+	for _, f := range c.tls.options {
+		f(c.tls, t.TLSClientConfig)
+	}
+}
+
+// dialTLS dials TLS connection applying settings of the host.
+// It reports handshake to the httptrace.ClientTrace, so Timing is measured.
+// Connections through proxy are dialed by the transport without host settings.
+func (s *tlsSettings) dialTLS(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	config := s.transport.TLSClientConfig.Clone()
+	if name, ok := s.serverNames[host]; ok {
+		config.ServerName = name
+	} else if config.ServerName == "" {
+		config.ServerName = host
+	}
+	if s.insecure[host] {
+		config.InsecureSkipVerify = true
+	}
+	// offer only protocols spoken by the transport, as it does for connections it dials
+	var protos []string
+	for _, proto := range config.NextProtos {
+		if _, ok := s.transport.TLSNextProto[proto]; ok || proto == "http/1.1" {
+			protos = append(protos, proto)
+		}
+	}
+	if len(protos) == 0 {
+		if _, ok := s.transport.TLSNextProto["h2"]; ok {
+			protos = append(protos, "h2")
+		}
+		protos = append(protos, "http/1.1")
+	}
+	config.NextProtos = protos
+
+	dial := s.transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: time.Second * 30, KeepAlive: time.Second * 30}).DialContext
+	}
+	conn, err := dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+	// handshake ends with deadline of the ctx or handshake timeout of the transport
+	deadline, _ := ctx.Deadline()
+	if timeout := s.transport.TLSHandshakeTimeout; timeout > 0 {
+		if d := time.Now().Add(timeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	tc := tls.Client(conn, config)
+	if !deadline.IsZero() {
+		tc.SetDeadline(deadline)
+	}
+	err = tc.Handshake()
+	if err == nil && !deadline.IsZero() {
+		err = tc.SetDeadline(time.Time{})
+	}
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(tc.ConnectionState(), err)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tc, nil
+}
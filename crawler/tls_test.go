@@ -0,0 +1,288 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crawler_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/crawler"
+)
+
+// crawlOne sends single Request to the server and returns Response.
+func crawlOne(t *testing.T, url string, opts ...Option) Response {
+	c := NewCrawler(1, opts...)
+	c.Start()
+	defer c.Stop()
+	r, _ := NewRequest("GET", url, nil)
+	c.Push(context.Background(), r)
+	select {
+	case res := <-c.Response():
+		if res.Response() != nil {
+			res.Response().Body.Close()
+		}
+		return res
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout")
+	}
+	return nil
+}
+
+func serverPool(server *httptest.Server) *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	return pool
+}
+
+func TestTLSVerification(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	if res := crawlOne(t, server.URL); res.Error() == nil {
+		t.Error("self signed certificate accepted")
+	}
+
+	res := crawlOne(t, server.URL, WithRootCAs(serverPool(server)))
+	if res.Error() != nil {
+		t.Fatal(res.Error())
+	}
+	info := ResponseTLS(res)
+	if info == nil || info.Version != "TLS 1.3" || info.CipherSuite == "" {
+		t.Fatalf("invalid tls: %+v", info)
+	}
+	if len(info.Certificates) != 1 || len(info.Chain) != 1 || info.Certificates[0].NotAfter.IsZero() || len(info.Certificates[0].SHA256) != 64 {
+		t.Errorf("invalid certificates: %+v", info.Certificates)
+	}
+
+	if res := crawlOne(t, server.URL, WithInsecureHosts("127.0.0.1")); res.Error() != nil {
+		t.Errorf("insecure host verified: %v", res.Error())
+	}
+	if res := crawlOne(t, server.URL, WithInsecureHosts("example.com")); res.Error() == nil {
+		t.Error("other host not verified")
+	}
+	// insecure hosts do not disable custom root CAs
+	if res := crawlOne(t, server.URL, WithInsecureHosts("example.com"), WithRootCAs(serverPool(server))); res.Error() != nil {
+		t.Error(res.Error())
+	}
+
+	// plain http has no tls
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	if info := ResponseTLS(crawlOne(t, plain.URL)); info != nil {
+		t.Errorf("plain http has tls: %+v", info)
+	}
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	res := crawlOne(t, server.URL, WithRootCAs(serverPool(server)))
+	if res.Error() != nil || ResponseTLS(res).Version != "TLS 1.2" {
+		t.Fatalf("want TLS 1.2, got %v %+v", res.Error(), ResponseTLS(res))
+	}
+	if res := crawlOne(t, server.URL, WithRootCAs(serverPool(server)), WithMinTLSVersion(tls.VersionTLS13)); res.Error() == nil {
+		t.Error("TLS 1.2 accepted")
+	}
+}
+
+func TestTLSServerName(t *testing.T) {
+	var mu sync.Mutex
+	var names []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		mu.Lock()
+		names = append(names, hello.ServerName)
+		mu.Unlock()
+		return nil, nil
+	}}
+	server.StartTLS()
+	defer server.Close()
+
+	// test certificate is valid for example.com
+	var handshake time.Duration
+	res := crawlOne(t, server.URL, WithRootCAs(serverPool(server)), WithServerName("127.0.0.1", "example.com"))
+	if res.Error() != nil {
+		t.Fatal(res.Error())
+	}
+	handshake = ResponseTiming(res).TLSHandshake
+	if res := crawlOne(t, server.URL, WithRootCAs(serverPool(server)), WithServerName("127.0.0.1", "other.com")); res.Error() == nil {
+		t.Error("certificate verified against other name")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(names) != 2 || names[0] != "example.com" || names[1] != "other.com" {
+		t.Errorf("invalid server names: %v", names)
+	}
+	if handshake <= 0 {
+		t.Error("handshake not measured")
+	}
+}
+
+func TestTLSNegotiatedProtocol(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	for _, tt := range []struct {
+		transport *http.Transport
+		proto     int
+	}{
+		{transport: &http.Transport{}, proto: 1},
+		{transport: &http.Transport{ForceAttemptHTTP2: true}, proto: 2},
+	} {
+		res := crawlOne(t, server.URL, WithClient(&http.Client{Transport: tt.transport}), WithInsecureHosts("127.0.0.1"))
+		if res.Error() != nil {
+			t.Fatal(res.Error())
+		}
+		if res.Response().ProtoMajor != tt.proto || (tt.proto == 2) != (ResponseTLS(res).NegotiatedProtocol == "h2") {
+			t.Errorf("want HTTP/%d, got %s %+v", tt.proto, res.Response().Proto, ResponseTLS(res))
+		}
+	}
+}
+
+func TestTLSTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := &http.Client{Transport: roundTripFunc(http.DefaultTransport.RoundTrip)}
+	res := crawlOne(t, server.URL, WithClient(client), WithLoggerOutput(ioutil.Discard), WithInsecureHosts("127.0.0.1"))
+	var err ErrorTLSTransport
+	if !errors.As(res.Error(), &err) {
+		t.Errorf("want ErrorTLSTransport, got %v", res.Error())
+	}
+}
+
+func TestTLSOptionsOrder(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// settings are not discarded by the later client
+	client := &http.Client{Transport: &http.Transport{}}
+	if res := crawlOne(t, server.URL, WithRootCAs(serverPool(server)), WithClient(client)); res.Error() != nil {
+		t.Error(res.Error())
+	}
+	if config := client.Transport.(*http.Transport).TLSClientConfig; config != nil && config.RootCAs != nil {
+		t.Error("client transport modified")
+	}
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	// listener that accepts connections, but never answers the handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	client := &http.Client{Transport: &http.Transport{TLSHandshakeTimeout: time.Millisecond * 100}}
+	start := time.Now()
+	res := crawlOne(t, "https://"+l.Addr().String(), WithClient(client), WithInsecureHosts("127.0.0.1"))
+	if res.Error() == nil {
+		t.Fatal("handshake succeeded")
+	}
+	if time.Since(start) > time.Second*2 {
+		t.Errorf("handshake timeout ignored: %v", time.Since(start))
+	}
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	if res := crawlOne(t, server.URL, WithRootCAs(serverPool(server))); res.Error() == nil {
+		t.Error("request without client certificate accepted")
+	}
+	res := crawlOne(t, server.URL, WithRootCAs(serverPool(server)), WithClientCertificate(testCertificate(t)))
+	if res.Error() != nil || res.Response().StatusCode != http.StatusOK {
+		t.Errorf("client certificate not sent: %v", res.Error())
+	}
+}
+
+func TestLoadCertPool(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir, _ := ioutil.TempDir("", "crawler-tls")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)
+
+	pool, err := LoadCertPool(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := crawlOne(t, server.URL, WithRootCAs(pool)); res.Error() != nil {
+		t.Error(res.Error())
+	}
+	if _, err := LoadCertPool(filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("missing file accepted")
+	}
+}
+
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
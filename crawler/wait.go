@@ -26,8 +26,8 @@ import (
 // period of time and it means that crawlers should be stopped.
 // After each 'tick' WaitUnknownTime checks len of responses and requests that crawlers made.
 // If these numbers didn't change between 'tick', n is increased by 1, otherwise n is zeroed.
-// When n equals `count` and channels of Response and Request are of len 0 - crawlers are stopped.
-// It mean's all Response object have to be taken out from the Queue before Crawler can stop.
+// When n equals `count`, Response channel and Queue are empty - crawlers are stopped.
+// It mean's all Response object have to be taken out from the channel before Crawler can stop.
 var WaitUnknownTime = func(c *Crawler, count int, tick time.Duration) {
 
 	var stopped = make(chan struct{}, 1)
@@ -62,7 +62,7 @@ var WaitUnknownTime = func(c *Crawler, count int, tick time.Duration) {
 				} else {
 					n = 0
 				}
-				if n >= count && len(c.Response()) == 0 && len(c.Request()) == 0 {
+				if n >= count && len(c.Response()) == 0 && c.Len() == 0 {
 					c.Stop()
 					return
 				}
@@ -16,6 +16,7 @@ limitations under the License.
 package crawler_test
 
 import (
+	"context"
 	. "github.com/bukowa/micro/crawler"
 	"io/ioutil"
 	"testing"
@@ -113,7 +114,7 @@ func TestWaiter2(t *testing.T) {
 				return
 			default:
 				req, _ := NewRequest("GET", "http://bad.url.domain", nil)
-				crawler.Request() <- req
+				crawler.Push(context.Background(), req)
 				<-crawler.Response()
 				time.Sleep(time.Millisecond * 100)
 			}
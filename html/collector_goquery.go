@@ -18,6 +18,7 @@ limitations under the License.
 import (
 	"github.com/PuerkitoBio/goquery"
 	"io"
+	"strings"
 )
 
 // GoQueryCollectFunc is a function that gathers items from given goquery.Document.
@@ -68,3 +69,18 @@ var CollectSelectorAttributes = func(selectors map[string][]string) GoQueryColle
 		return values
 	}
 }
+
+// CollectSelectorText gathers trimmed text of elements matching given selectors.
+// Elements without text are skipped.
+var CollectSelectorText = func(selectors ...string) GoQueryCollectFunc {
+	return func(doc *goquery.Document) (values []string) {
+		for _, selector := range selectors {
+			doc.Find(selector).Each(func(i int, selection *goquery.Selection) {
+				if text := strings.TrimSpace(selection.Text()); text != "" {
+					values = append(values, text)
+				}
+			})
+		}
+		return values
+	}
+}
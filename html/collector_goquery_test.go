@@ -21,6 +21,7 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -40,6 +41,17 @@ func TestCollectSelectorAttributes(t *testing.T) {
 	}
 }
 
+func TestCollectSelectorText(t *testing.T) {
+	var writer = &testWriter{}
+	var collector = NewGoQueryCollector(CollectSelectorText("title", "h1"))
+	if err := collector.Collect(strings.NewReader(`<title> Title </title><h1>One</h1><h1> </h1><h1>Two</h1>`), writer); err != nil {
+		t.Error(err)
+	}
+	if len(writer.written) != 3 || string(writer.written[0]) != "Title" || string(writer.written[2]) != "Two" {
+		t.Errorf("invalid text collected: %q", writer.written)
+	}
+}
+
 type testWriter struct {
 	written [][]byte
 }
@@ -0,0 +1,281 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package html
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/bukowa/micro/crawler"
+)
+
+// Form encodings.
+const (
+	EnctypeURLEncoded = "application/x-www-form-urlencoded"
+	EnctypeMultipart  = "multipart/form-data"
+)
+
+// Form is a html form.
+type Form struct {
+	Name string `json:"name,omitempty"`
+	ID   string `json:"id,omitempty"`
+	// Action is an url the form is submitted to, resolved against url of the document if it's known.
+	Action string `json:"action"`
+	// Method is an uppercase method of the form, GET or POST.
+	Method string `json:"method"`
+	// Enctype is an encoding of POST forms, EnctypeURLEncoded or EnctypeMultipart.
+	Enctype string  `json:"enctype"`
+	Fields  []Field `json:"fields"`
+}
+
+// Field is an input, select, textarea or button of the Form.
+type Field struct {
+	Name string `json:"name"`
+	// Type is a type of input, or select, textarea or button.
+	Type     string `json:"type"`
+	Value    string `json:"value,omitempty"`
+	Checked  bool   `json:"checked,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+	// Multiple is true for selects allowing many options.
+	Multiple bool          `json:"multiple,omitempty"`
+	Options  []FieldOption `json:"options,omitempty"`
+}
+
+// FieldOption is an option of select Field.
+type FieldOption struct {
+	Value    string `json:"value"`
+	Label    string `json:"label,omitempty"`
+	Selected bool   `json:"selected,omitempty"`
+}
+
+// ParseForms returns forms of the document, actions are resolved against base if it's not nil.
+func ParseForms(r io.Reader, base *url.URL) ([]Form, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+	doc.Url = base
+	return Forms(doc), nil
+}
+
+// Forms returns forms of the goquery.Document.
+func Forms(doc *goquery.Document) (forms []Form) {
+	doc.Find("form").Each(func(i int, s *goquery.Selection) {
+		forms = append(forms, newForm(s, doc.Url))
+	})
+	return forms
+}
+
+// CollectForms gathers json encoded forms, it can be used with NewGoQueryCollector.
+var CollectForms = func(doc *goquery.Document) (values []string) {
+	for _, f := range Forms(doc) {
+		b, err := json.Marshal(f)
+		if err != nil {
+			continue
+		}
+		values = append(values, string(b))
+	}
+	return values
+}
+
+func newForm(s *goquery.Selection, base *url.URL) Form {
+	f := Form{
+		Name:    s.AttrOr("name", ""),
+		ID:      s.AttrOr("id", ""),
+		Action:  strings.TrimSpace(s.AttrOr("action", "")),
+		Method:  strings.ToUpper(strings.TrimSpace(s.AttrOr("method", ""))),
+		Enctype: strings.ToLower(strings.TrimSpace(s.AttrOr("enctype", ""))),
+	}
+	if f.Method != http.MethodPost {
+		f.Method = http.MethodGet
+	}
+	if f.Enctype != EnctypeMultipart {
+		f.Enctype = EnctypeURLEncoded
+	}
+	if base != nil {
+		if u, err := base.Parse(f.Action); err == nil {
+			u.Fragment, u.RawFragment = "", ""
+			f.Action = u.String()
+		}
+	}
+
+	s.Find("input, select, textarea, button").Each(func(i int, s *goquery.Selection) {
+		name, ok := s.Attr("name")
+		if !ok || name == "" {
+			return
+		}
+		field := Field{Name: name}
+		_, field.Disabled = s.Attr("disabled")
+		switch tag := goquery.NodeName(s); tag {
+		case "input":
+			field.Type = strings.ToLower(s.AttrOr("type", "text"))
+			field.Value = s.AttrOr("value", "")
+			_, field.Checked = s.Attr("checked")
+			if (field.Type == "checkbox" || field.Type == "radio") && field.Value == "" {
+				field.Value = "on"
+			}
+		case "select":
+			field.Type = tag
+			_, field.Multiple = s.Attr("multiple")
+			s.Find("option").Each(func(i int, o *goquery.Selection) {
+				label := strings.TrimSpace(o.Text())
+				option := FieldOption{Value: o.AttrOr("value", label), Label: label}
+				_, option.Selected = o.Attr("selected")
+				field.Options = append(field.Options, option)
+			})
+		case "textarea":
+			field.Type = tag
+			field.Value = s.Text()
+		case "button":
+			field.Type = strings.ToLower(s.AttrOr("type", "submit"))
+			field.Value = s.AttrOr("value", "")
+		}
+		f.Fields = append(f.Fields, field)
+	})
+	return f
+}
+
+// Values returns values submitted by the form without changes,
+// including hidden fields like csrf tokens. Buttons, file inputs,
+// unchecked and disabled fields are not submitted.
+func (f Form) Values() url.Values {
+	var values = url.Values{}
+	for _, p := range f.pairs() {
+		values.Add(p.name, p.value)
+	}
+	return values
+}
+
+// pair is a name and value submitted by the Form.
+type pair struct {
+	name  string
+	value string
+}
+
+// pairs returns values submitted by the Form in document order.
+func (f Form) pairs() (pairs []pair) {
+	var add = func(name, value string) {
+		pairs = append(pairs, pair{name: name, value: value})
+	}
+	for _, field := range f.Fields {
+		if field.Disabled {
+			continue
+		}
+		switch field.Type {
+		case "submit", "button", "image", "reset", "file":
+		case "checkbox", "radio":
+			if field.Checked {
+				add(field.Name, field.Value)
+			}
+		case "select":
+			var selected bool
+			for _, o := range field.Options {
+				if o.Selected && (field.Multiple || !selected) {
+					add(field.Name, o.Value)
+					selected = true
+				}
+			}
+			// single select without selected option submits the first one
+			if !selected && !field.Multiple && len(field.Options) > 0 {
+				add(field.Name, field.Options[0].Value)
+			}
+		default:
+			add(field.Name, field.Value)
+		}
+	}
+	return pairs
+}
+
+// NewFormRequest creates Request submitting the Form.
+// Values of the form are replaced by values of override with the same name.
+// If parent is not nil, Request is its child.
+func NewFormRequest(parent crawler.Request, f Form, override url.Values) (crawler.Request, error) {
+	values := f.Values()
+	for name, v := range override {
+		values[name] = v
+	}
+
+	var newRequest = func(method, url string, body io.Reader) (crawler.Request, error) {
+		if parent != nil {
+			return crawler.NewChildRequest(parent, method, url, body)
+		}
+		return crawler.NewRequest(method, url, body)
+	}
+
+	if f.Method != http.MethodPost {
+		action, err := url.Parse(f.Action)
+		if err != nil {
+			return nil, err
+		}
+		action.RawQuery = values.Encode()
+		return newRequest(http.MethodGet, action.String(), nil)
+	}
+
+	var body = &bytes.Buffer{}
+	var contentType = EnctypeURLEncoded
+	if f.Enctype == EnctypeMultipart {
+		w := multipart.NewWriter(body)
+		// fields are written in document order, overridden fields
+		// at their first occurrence and new ones sorted by name
+		var written = map[string]bool{}
+		var write = func(name string) error {
+			if written[name] {
+				return nil
+			}
+			written[name] = true
+			for _, v := range values[name] {
+				if err := w.WriteField(name, v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for _, p := range f.pairs() {
+			if err := write(p.name); err != nil {
+				return nil, err
+			}
+		}
+		var names []string
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := write(name); err != nil {
+				return nil, err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		contentType = w.FormDataContentType()
+	} else {
+		body.WriteString(values.Encode())
+	}
+	r, err := newRequest(http.MethodPost, f.Action, body)
+	if err != nil {
+		return nil, err
+	}
+	r.Request().Header.Set("Content-Type", contentType)
+	return r, nil
+}
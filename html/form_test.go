@@ -0,0 +1,176 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package html_test
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bukowa/micro/crawler"
+	. "github.com/bukowa/micro/html"
+)
+
+const testForms = `
+<form id="search" action="/search#results">
+	<input name="q" value="default">
+	<input type="hidden" name="csrf" value="token">
+	<input type="checkbox" name="exact">
+	<input type="checkbox" name="safe" value="1" checked>
+	<input type="radio" name="sort" value="date">
+	<input type="radio" name="sort" value="score" checked>
+	<select name="lang"><option>en</option><option value="pl">Polish</option></select>
+	<select name="tags" multiple><option value="a" selected>A</option><option value="b" selected>B</option></select>
+	<input name="old" value="x" disabled>
+	<input type="submit" name="go" value="Search">
+</form>
+<form name="upload" method="post" enctype="multipart/form-data" action="https://other.com/upload">
+	<textarea name="text">hello</textarea>
+	<input type="file" name="file">
+	<button name="send" value="1">Send</button>
+</form>
+<form method="POST"><input name="a" value="1"></form>
+`
+
+func TestParseForms(t *testing.T) {
+	base, _ := url.Parse("http://example.com/page?x=1")
+	forms, err := ParseForms(strings.NewReader(testForms), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forms) != 3 {
+		t.Fatalf("want 3 forms, got %d", len(forms))
+	}
+	search, upload, post := forms[0], forms[1], forms[2]
+	if search.ID != "search" || search.Action != "http://example.com/search" || search.Method != "GET" || search.Enctype != EnctypeURLEncoded {
+		t.Errorf("invalid form: %+v", search)
+	}
+	if len(search.Fields) != 10 {
+		t.Errorf("want 10 fields, got %d", len(search.Fields))
+	}
+	if upload.Name != "upload" || upload.Method != "POST" || upload.Enctype != EnctypeMultipart || upload.Action != "https://other.com/upload" {
+		t.Errorf("invalid form: %+v", upload)
+	}
+	if post.Action != "http://example.com/page?x=1" {
+		t.Errorf("empty action should be document url: %s", post.Action)
+	}
+
+	want := url.Values{
+		"q":    {"default"},
+		"csrf": {"token"},
+		"safe": {"1"},
+		"sort": {"score"},
+		"lang": {"en"},
+		"tags": {"a", "b"},
+	}
+	if got := search.Values().Encode(); got != want.Encode() {
+		t.Errorf("want %s, got %s", want.Encode(), got)
+	}
+	if got := upload.Values().Encode(); got != "text=hello" {
+		t.Errorf("invalid values: %s", got)
+	}
+}
+
+func TestNewFormRequest(t *testing.T) {
+	base, _ := url.Parse("http://example.com/")
+	forms, _ := ParseForms(strings.NewReader(testForms), base)
+	parent, _ := crawler.NewRequest("GET", "http://example.com/", nil)
+
+	r, err := NewFormRequest(parent, forms[0], url.Values{"q": {"golang"}, "tags": {"c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Request().Method != "GET" || crawler.RequestDepth(r) != 1 {
+		t.Errorf("invalid request: %s %d", r.Request().Method, crawler.RequestDepth(r))
+	}
+	q := r.Request().URL.Query()
+	if q.Get("q") != "golang" || q.Get("csrf") != "token" || len(q["tags"]) != 1 || q.Get("tags") != "c" {
+		t.Errorf("invalid query: %s", r.Request().URL.RawQuery)
+	}
+
+	r, err = NewFormRequest(nil, forms[1], url.Values{"extra": {"1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Request().ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if r.Request().FormValue("text") != "hello" || r.Request().FormValue("extra") != "1" {
+		t.Errorf("invalid multipart form: %v", r.Request().MultipartForm.Value)
+	}
+
+	r, err = NewFormRequest(nil, forms[2], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(r.Request().Body)
+	if r.Request().Header.Get("Content-Type") != EnctypeURLEncoded || string(body) != "a=1" {
+		t.Errorf("invalid urlencoded request: %s", body)
+	}
+}
+
+func TestNewFormRequestMultipartOrder(t *testing.T) {
+	base, _ := url.Parse("http://example.com/")
+	forms, _ := ParseForms(strings.NewReader(`
+<form method="post" enctype="multipart/form-data" action="/upload">
+	<input name="z" value="1"><input name="b" value="2"><input name="m" value="3">
+	<input name="a" value="4"><input name="b" value="5">
+</form>`), base)
+	r, err := NewFormRequest(nil, forms[0], url.Values{"m": {"x"}, "y": {"6"}, "c": {"7"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr, err := r.Request().MultipartReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, _ := ioutil.ReadAll(part)
+		got = append(got, part.FormName()+"="+string(value))
+	}
+	want := "z=1 b=2 b=5 m=x a=4 c=7 y=6"
+	if strings.Join(got, " ") != want {
+		t.Errorf("want %s, got %s", want, strings.Join(got, " "))
+	}
+}
+
+func TestCollectForms(t *testing.T) {
+	var writer = &testWriter{}
+	if err := NewGoQueryCollector(CollectForms).Collect(strings.NewReader(testForms), writer); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.written) != 3 {
+		t.Fatalf("want 3 forms, got %d", len(writer.written))
+	}
+	var f Form
+	if err := json.Unmarshal(writer.written[1], &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "upload" || len(f.Fields) != 3 {
+		t.Errorf("invalid form: %+v", f)
+	}
+}
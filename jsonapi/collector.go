@@ -0,0 +1,72 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package jsonapi
+
+import (
+	"io"
+
+	"github.com/bukowa/micro/html"
+)
+
+// CollectFunc is a function that gathers items from decoded json document.
+type CollectFunc = func(v interface{}) []string
+
+// Collector is a json counterpart of html.GoQueryCollector.
+// It decodes json document and writes values gathered by each CollectFunc.
+type Collector struct {
+	CollectFunc []CollectFunc
+}
+
+// NewCollector returns new Collector.
+func NewCollector(collect ...CollectFunc) html.Collector {
+	return &Collector{
+		CollectFunc: collect,
+	}
+}
+
+func (c *Collector) Collect(r io.Reader, w io.Writer) error {
+	doc, err := Decode(r)
+	if err != nil {
+		return err
+	}
+	for _, f := range c.CollectFunc {
+		for _, v := range f(doc) {
+			if _, err := w.Write([]byte(v)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CollectPath gathers values selected by given paths, formatted with String.
+// Null values are skipped.
+// Example:
+//
+//	CollectPath(MustParsePath("data[*].id"))
+var CollectPath = func(paths ...Path) CollectFunc {
+	return func(v interface{}) (values []string) {
+		for _, p := range paths {
+			for _, value := range p.Get(v) {
+				if value == nil {
+					continue
+				}
+				values = append(values, String(value))
+			}
+		}
+		return values
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package jsonapi_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/bukowa/micro/jsonapi"
+)
+
+type testWriter struct {
+	written []string
+}
+
+func (w *testWriter) Write(p []byte) (int, error) {
+	w.written = append(w.written, string(p))
+	return len(p), nil
+}
+
+func TestCollectPath(t *testing.T) {
+	var writer = &testWriter{}
+	var collector = NewCollector(
+		CollectPath(MustParsePath("data[*].name")),
+		CollectPath(MustParsePath("meta.total"), MustParsePath("data[0]")),
+	)
+	if err := collector.Collect(strings.NewReader(document), writer); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "b", "30", `{"id":1,"name":"a","tags":["x","y"]}`}
+	if !reflect.DeepEqual(writer.written, want) {
+		t.Errorf("want %v, got %v", want, writer.written)
+	}
+	if err := collector.Collect(strings.NewReader("<html>"), writer); err == nil {
+		t.Error("want error for invalid json")
+	}
+}
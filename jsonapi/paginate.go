@@ -0,0 +1,324 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package jsonapi
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bukowa/micro/crawler"
+)
+
+// Paginator creates Request of the page following the Response.
+type Paginator interface {
+	// Next returns nil Request when there are no more pages.
+	// Doc is decoded json body of the Response, nil if body is not json.
+	Next(r crawler.Response, doc interface{}) (crawler.Request, error)
+}
+
+// WithPagination follows pages of successful responses with the first Paginator
+// that returns next page. Pages are children of the Response and they are sent
+// to the Queue of the Crawler until paginators are exhausted, pages that do not fit
+// into the full Queue are not followed.
+// Json bodies are buffered, so they can be still read from responses.
+var WithPagination = func(paginators ...Paginator) crawler.Option {
+	return func(c *crawler.Crawler) {
+		c.OnResponse(func(i int, c *crawler.Crawler, r crawler.Response) error {
+			next, err := Paginate(r, paginators...)
+			if err != nil {
+				c.Print("pagination of ", r.Request().URL, " failed: ", err)
+				return nil
+			}
+			// workers must not block on full Queue
+			if next != nil {
+				if err := c.TryPush(next); err != nil {
+					c.Print("pagination of ", r.Request().URL, " failed: ", err)
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// Paginate returns Request of the page following the Response created by the first
+// Paginator that returns next page. Failed and non 2xx responses have no next page.
+func Paginate(r crawler.Response, paginators ...Paginator) (crawler.Request, error) {
+	res := r.Response()
+	if r.Error() != nil || res == nil || res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, nil
+	}
+	var doc interface{}
+	if strings.Contains(res.Header.Get("Content-Type"), "json") && res.Body != nil {
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = Decode(bytes.NewReader(body)); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range paginators {
+		next, err := p.Next(r, doc)
+		if err != nil || next != nil {
+			return next, err
+		}
+	}
+	return nil, nil
+}
+
+// PageNumber paginates with page number query parameter, like ?page=2.
+// Pagination stops at page without items or at the last page.
+type PageNumber struct {
+	// Param is a name of the query parameter.
+	Param string
+	// Start is a number of the first page, requests without Param are on the Start page.
+	Start int
+	// Items selects items of the page, by default the document is the array of items.
+	Items Path
+	// Pages optionally selects count of pages.
+	Pages Path
+}
+
+// NewPageNumber creates PageNumber starting at page 1.
+func NewPageNumber(param string, items Path) *PageNumber {
+	return &PageNumber{Param: param, Start: 1, Items: items}
+}
+
+func (p *PageNumber) Next(r crawler.Response, doc interface{}) (crawler.Request, error) {
+	query := r.Request().URL.Query()
+	page, err := queryInt(query, p.Param, p.Start)
+	if err != nil {
+		return nil, err
+	}
+	pages, ok, err := pathInt(p.Pages, doc)
+	if err != nil {
+		return nil, err
+	}
+	if ok && page-p.Start+1 >= pages {
+		return nil, nil
+	}
+	if count(p.Items, doc) == 0 {
+		return nil, nil
+	}
+	query.Set(p.Param, strconv.Itoa(page+1))
+	return NextPage(r, query)
+}
+
+// OffsetLimit paginates with offset and limit query parameters, like ?offset=20&limit=10.
+// Pagination stops when offset reached the total or, if total is unknown,
+// at page with less items than the limit.
+type OffsetLimit struct {
+	OffsetParam string
+	LimitParam  string
+	// Limit is used when request has no LimitParam, it's set in the following pages.
+	Limit int
+	// Items selects items of the page, by default the document is the array of items.
+	Items Path
+	// Total optionally selects count of all items.
+	Total Path
+}
+
+// NewOffsetLimit creates OffsetLimit with "offset" and "limit" parameters.
+func NewOffsetLimit(limit int, items Path) *OffsetLimit {
+	return &OffsetLimit{OffsetParam: "offset", LimitParam: "limit", Limit: limit, Items: items}
+}
+
+func (p *OffsetLimit) Next(r crawler.Response, doc interface{}) (crawler.Request, error) {
+	query := r.Request().URL.Query()
+	offset, err := queryInt(query, p.OffsetParam, 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt(query, p.LimitParam, p.Limit)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid limit %d", limit)
+	}
+	total, ok, err := pathInt(p.Total, doc)
+	if err != nil {
+		return nil, err
+	}
+	if ok && offset+limit >= total || !ok && count(p.Items, doc) < limit {
+		return nil, nil
+	}
+	query.Set(p.OffsetParam, strconv.Itoa(offset+limit))
+	if p.LimitParam != "" {
+		query.Set(p.LimitParam, strconv.Itoa(limit))
+	}
+	return NextPage(r, query)
+}
+
+// Cursor paginates with cursor of the next page found in the body, like ?cursor=dXNlcjoxMA.
+// Pagination stops when the cursor is missing, empty or the same as cursor of the request.
+type Cursor struct {
+	// Param is a name of the query parameter.
+	Param string
+	// Path selects cursor of the next page.
+	Path Path
+}
+
+// NewCursor creates new Cursor.
+func NewCursor(param string, path Path) *Cursor {
+	return &Cursor{Param: param, Path: path}
+}
+
+func (p *Cursor) Next(r crawler.Response, doc interface{}) (crawler.Request, error) {
+	v, _ := p.Path.First(doc)
+	cursor := String(v)
+	query := r.Request().URL.Query()
+	if cursor == "" || cursor == query.Get(p.Param) {
+		return nil, nil
+	}
+	query.Set(p.Param, cursor)
+	return NextPage(r, query)
+}
+
+// LinkHeader paginates with RFC 5988 Link header of the Response, like
+// Link: <https://api.example.com/items?page=2>; rel="next".
+type LinkHeader struct{}
+
+func (LinkHeader) Next(r crawler.Response, doc interface{}) (crawler.Request, error) {
+	link := NextLink(r.Response().Header)
+	if link == "" {
+		return nil, nil
+	}
+	u, err := r.Request().URL.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	return nextRequest(r, u)
+}
+
+// NextLink returns target of the Link header with "next" relation.
+func NextLink(header http.Header) string {
+	for _, value := range header.Values("Link") {
+		for _, link := range splitLinks(value) {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "rel") {
+					continue
+				}
+				// relation can be a space separated list of relations
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(kv[1]), `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// splitLinks splits Link header value on commas outside of targets and quoted strings.
+func splitLinks(value string) (links []string) {
+	var start int
+	var target, quoted bool
+	for i, r := range value {
+		switch {
+		case r == '"' && !target:
+			quoted = !quoted
+		case r == '<' && !quoted:
+			target = true
+		case r == '>' && !quoted:
+			target = false
+		case r == ',' && !quoted && !target:
+			links = append(links, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(links, value[start:])
+}
+
+// NextPage creates Request of the next page with the url of the Response and query replaced.
+func NextPage(r crawler.Response, query url.Values) (crawler.Request, error) {
+	u := *r.Request().URL
+	u.RawQuery = query.Encode()
+	return nextRequest(r, &u)
+}
+
+// nextRequest creates child GET Request with headers of the Response Request.
+// Credentials are not sent to other hosts.
+func nextRequest(r crawler.Response, u *url.URL) (crawler.Request, error) {
+	next, err := crawler.NewChildRequest(r, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	header := r.Request().Header.Clone()
+	if u.Host != r.Request().URL.Host {
+		header.Del("Authorization")
+		header.Del("Cookie")
+	}
+	next.Request().Header = header
+	return next, nil
+}
+
+// count returns count of items selected by the Path.
+// Single selected array is counted as its items.
+func count(p Path, doc interface{}) int {
+	values := p.Get(doc)
+	if len(values) == 1 {
+		switch v := values[0].(type) {
+		case nil:
+			return 0
+		case []interface{}:
+			return len(v)
+		}
+	}
+	return len(values)
+}
+
+func queryInt(query url.Values, param string, def int) (int, error) {
+	v := query.Get(param)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s parameter %q", param, v)
+	}
+	return i, nil
+}
+
+// pathInt returns number selected by the Path, nil Path selects nothing.
+func pathInt(p Path, doc interface{}) (int, bool, error) {
+	if p == nil {
+		return 0, false, nil
+	}
+	v, ok := p.First(doc)
+	if !ok || v == nil {
+		return 0, false, nil
+	}
+	i, err := strconv.Atoi(String(v))
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid number %q", String(v))
+	}
+	return i, true, nil
+}
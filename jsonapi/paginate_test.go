@@ -0,0 +1,155 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package jsonapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bukowa/micro/crawler"
+	. "github.com/bukowa/micro/jsonapi"
+)
+
+// items serves 25 items with page, offset/limit and cursor parameters.
+var items = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	const total = 25
+	var q = r.URL.Query()
+	var from, size = 0, 10
+	if page, err := strconv.Atoi(q.Get("page")); err == nil {
+		from = (page - 1) * size
+	}
+	if offset, err := strconv.Atoi(q.Get("offset")); err == nil {
+		from = offset
+	}
+	if limit, err := strconv.Atoi(q.Get("limit")); err == nil {
+		size = limit
+	}
+	if cursor, err := strconv.Atoi(q.Get("cursor")); err == nil {
+		from = cursor
+	}
+	var page = []int{}
+	for i := from; i < from+size && i < total; i++ {
+		page = append(page, i)
+	}
+	var next string
+	if from+size < total {
+		next = strconv.Itoa(from + size)
+		w.Header().Add("Link", fmt.Sprintf(`<%s?offset=%s>; rel="next last", <%s>; rel="first"`, r.URL.Path, next, r.URL.Path))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": page,
+		"meta":  map[string]interface{}{"total": total, "pages": 3, "next": next},
+	})
+})
+
+func paginate(t *testing.T, url string, p ...Paginator) (queries []string) {
+	server := httptest.NewServer(items)
+	defer server.Close()
+	c := crawler.NewCrawler(2, WithPagination(p...))
+	c.Start()
+	defer c.Stop()
+	r, _ := crawler.NewRequest("GET", server.URL+url, nil)
+	r.Request().Header.Set("Accept", "application/json")
+	c.Push(context.Background(), r)
+	for {
+		select {
+		case res := <-c.Response():
+			if res.Error() != nil {
+				t.Fatal(res.Error())
+			}
+			if res.Request().Header.Get("Accept") != "application/json" {
+				t.Error("headers not copied to next page")
+			}
+			// body can be still read
+			if b, _ := ioutil.ReadAll(res.Response().Body); len(b) == 0 {
+				t.Error("empty body")
+			}
+			queries = append(queries, fmt.Sprintf("%d:%s", crawler.RequestDepth(res), res.Request().URL.RawQuery))
+		case <-time.After(time.Millisecond * 300):
+			return queries
+		}
+	}
+}
+
+func TestPagination(t *testing.T) {
+	var tests = []struct {
+		name string
+		url  string
+		p    Paginator
+		want []string
+	}{
+		{"page", "/items", NewPageNumber("page", MustParsePath("items")),
+			[]string{"0:", "1:page=2", "2:page=3", "3:page=4"}},
+		{"pages", "/items", &PageNumber{Param: "page", Start: 1, Pages: MustParsePath("meta.pages")},
+			[]string{"0:", "1:page=2", "2:page=3"}},
+		{"offset", "/items?limit=10", NewOffsetLimit(0, MustParsePath("items")),
+			[]string{"0:limit=10", "1:limit=10&offset=10", "2:limit=10&offset=20"}},
+		{"total", "/items", &OffsetLimit{OffsetParam: "offset", LimitParam: "limit", Limit: 20, Total: MustParsePath("meta.total")},
+			[]string{"0:", "1:limit=20&offset=20"}},
+		{"cursor", "/items", NewCursor("cursor", MustParsePath("meta.next")),
+			[]string{"0:", "1:cursor=10", "2:cursor=20"}},
+		{"link", "/items", LinkHeader{},
+			[]string{"0:", "1:offset=10", "2:offset=20"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := paginate(t, tt.url, tt.p)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	var tests = map[string]string{
+		`<https://a.com/?page=2>; rel="next"`:                             "https://a.com/?page=2",
+		`<https://a.com/?a=1,2>; rel="prev", <https://a.com/3>; rel=next`: "https://a.com/3",
+		`<https://a.com/>; title="a, rel=next"; rel="last"`:               "",
+		`<https://a.com/>; REL="Next"`:                                    "https://a.com/",
+	}
+	for value, want := range tests {
+		if got := NextLink(http.Header{"Link": {value}}); got != want {
+			t.Errorf("%s: want %q, got %q", value, want, got)
+		}
+	}
+}
+
+func TestNextPageCredentials(t *testing.T) {
+	r, _ := crawler.NewRequest("GET", "http://a.com/items", nil)
+	r.Request().Header.Set("Authorization", "secret")
+	res := crawler.NewResponse(nil, 0, r, &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Link": {`<http://b.com/items?page=2>; rel="next"`}},
+		Body:       http.NoBody,
+	}, nil)
+	next, err := Paginate(res, LinkHeader{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Request().URL.Host != "b.com" || next.Request().Header.Get("Authorization") != "" {
+		t.Errorf("credentials sent to other host: %v", next.Request().Header)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package jsonapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Path is a compiled path expression selecting values of decoded json documents.
+// Expressions consist of keys separated with dots, indexes and wildcards:
+//
+//	$.data.items[*].id
+//	meta["next-cursor"]
+//	results[0].links.*
+//
+// Leading "$" is optional, "*" selects all elements of arrays and values of objects.
+type Path []segment
+
+type segment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// ErrorPath is returned when path expression cannot be parsed.
+type ErrorPath string
+
+func (e ErrorPath) Error() string {
+	return fmt.Sprintf("invalid json path %q", string(e))
+}
+
+// ParsePath compiles path expression.
+func ParsePath(expr string) (Path, error) {
+	var p = Path{}
+	var s = strings.TrimPrefix(strings.TrimSpace(expr), "$")
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			if len(s) == 0 || s[0] == '.' || s[0] == '[' {
+				return nil, ErrorPath(expr)
+			}
+		case '[':
+			if len(s) > 1 && (s[1] == '"' || s[1] == '\'') {
+				// quoted keys may contain any characters but the quote
+				closing := strings.IndexByte(s[2:], s[1])
+				if closing < 0 || 2+closing+1 >= len(s) || s[2+closing+1] != ']' {
+					return nil, ErrorPath(expr)
+				}
+				p = append(p, segment{key: s[2 : 2+closing]})
+				s = s[2+closing+2:]
+				continue
+			}
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, ErrorPath(expr)
+			}
+			if inner := strings.TrimSpace(s[1:end]); inner == "*" {
+				p = append(p, segment{wildcard: true})
+			} else {
+				i, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, ErrorPath(expr)
+				}
+				p = append(p, segment{index: i, isIndex: true})
+			}
+			s = s[end+1:]
+			continue
+		}
+		end := strings.IndexAny(s, ".[")
+		if end < 0 {
+			end = len(s)
+		}
+		if end == 0 {
+			return nil, ErrorPath(expr)
+		}
+		if key := s[:end]; key == "*" {
+			p = append(p, segment{wildcard: true})
+		} else {
+			p = append(p, segment{key: key})
+		}
+		s = s[end:]
+	}
+	return p, nil
+}
+
+// MustParsePath is like ParsePath but panics if expression cannot be parsed.
+func MustParsePath(expr string) Path {
+	p, err := ParsePath(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Get returns values selected by the Path.
+// Negative indexes count from the end of arrays.
+func (p Path) Get(v interface{}) []interface{} {
+	var values = []interface{}{v}
+	for _, seg := range p {
+		var next []interface{}
+		for _, v := range values {
+			switch v := v.(type) {
+			case map[string]interface{}:
+				if seg.wildcard {
+					for _, key := range sortedKeys(v) {
+						next = append(next, v[key])
+					}
+				} else if value, ok := v[seg.key]; ok && !seg.isIndex {
+					next = append(next, value)
+				}
+			case []interface{}:
+				switch {
+				case seg.wildcard:
+					next = append(next, v...)
+				case seg.isIndex:
+					i := seg.index
+					if i < 0 {
+						i += len(v)
+					}
+					if i >= 0 && i < len(v) {
+						next = append(next, v[i])
+					}
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// First returns the first value selected by the Path.
+func (p Path) First(v interface{}) (interface{}, bool) {
+	values := p.Get(v)
+	if len(values) == 0 {
+		return nil, false
+	}
+	return values[0], true
+}
+
+// Decode decodes json document, numbers are decoded as json.Number.
+func Decode(r io.Reader) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// String formats decoded json value, strings and numbers are returned as they are,
+// other values are json encoded and null is an empty string.
+func String(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
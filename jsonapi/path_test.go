@@ -0,0 +1,77 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package jsonapi_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/bukowa/micro/jsonapi"
+)
+
+const document = `{
+	"data": [
+		{"id": 1, "name": "a", "tags": ["x", "y"]},
+		{"id": 2, "name": "b", "tags": []},
+		{"id": 3, "name": null}
+	],
+	"meta": {"next-cursor": "c2", "total": 30, "a]b": true}
+}`
+
+func TestPathGet(t *testing.T) {
+	doc, err := Decode(strings.NewReader(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		expr string
+		want []string
+	}{
+		{"data[*].id", []string{"1", "2", "3"}},
+		{"$.data[0].name", []string{"a"}},
+		{"data[-1].id", []string{"3"}},
+		{"data[5].id", nil},
+		{"data.*.tags[*]", []string{"x", "y"}},
+		{`meta["next-cursor"]`, []string{"c2"}},
+		{`meta['a]b']`, []string{"true"}},
+		{"meta.total", []string{"30"}},
+		{"data[1].tags", []string{"[]"}},
+		{"data[2].name", []string{""}},
+		{"meta.missing", nil},
+		{"meta[0]", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, v := range MustParsePath(tt.expr).Get(doc) {
+			got = append(got, String(v))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: want %v, got %v", tt.expr, tt.want, got)
+		}
+	}
+}
+
+func TestParsePathError(t *testing.T) {
+	for _, expr := range []string{"a..b", "a.", "a[", "a[x]", `a["b]`, `a["b"c]`, "a.[0]"} {
+		if _, err := ParsePath(expr); err != ErrorPath(expr) {
+			t.Errorf("%s: want ErrorPath, got %v", expr, err)
+		}
+	}
+	if p, err := ParsePath("$"); err != nil || len(p) != 0 {
+		t.Errorf("root path: %v %v", p, err)
+	}
+}
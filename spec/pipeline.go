@@ -0,0 +1,345 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package spec
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bukowa/micro/crawler"
+	"github.com/bukowa/micro/html"
+	"github.com/bukowa/micro/selector"
+)
+
+// Pipeline is a crawl instantiated from Spec.
+// Responses are turned into records written to Storage
+// and links extracted by following ExtractSpec are crawled.
+type Pipeline struct {
+	*crawler.Crawler
+
+	spec    *Spec
+	allow   []selector.Selector
+	deny    []selector.Selector
+	extract []extractor
+	storage Storage
+	report  *crawler.Reporter
+
+	// pending requests wait for space in the Queue
+	mu      sync.Mutex
+	pending []crawler.Request
+}
+
+type extractor struct {
+	ExtractSpec
+	collector html.Collector
+}
+
+// New validates Spec and creates Pipeline, opts are applied to the Crawler after options from Spec.
+// Text and jsonl storages without path write to stdout.
+func New(s *Spec, stdout io.Writer, opts ...crawler.Option) (*Pipeline, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	p := &Pipeline{spec: s}
+	for _, sel := range s.Scope.Allow {
+		v, err := sel.New()
+		if err != nil {
+			return nil, err
+		}
+		p.allow = append(p.allow, v)
+	}
+	for _, sel := range s.Scope.Deny {
+		v, err := sel.New()
+		if err != nil {
+			return nil, err
+		}
+		p.deny = append(p.deny, v)
+	}
+	for _, e := range s.Extract {
+		var funcs []html.GoQueryCollectFunc
+		if len(e.Attributes) > 0 {
+			funcs = append(funcs, html.CollectSelectorAttributes(map[string][]string{e.Selector: e.Attributes}))
+		}
+		if e.Text {
+			funcs = append(funcs, html.CollectSelectorText(e.Selector))
+		}
+		p.extract = append(p.extract, extractor{ExtractSpec: e, collector: html.NewGoQueryCollector(funcs...)})
+	}
+
+	c := s.Crawler
+	size := c.Size
+	if size == 0 {
+		size = 4
+	}
+	var options = []crawler.Option{crawler.WithSeen(crawler.NewSeen())}
+	if c.Sleep > 0 {
+		options = append(options, crawler.WithSleep(time.Duration(c.Sleep)))
+	}
+	if c.Log {
+		options = append(options, crawler.WithDefaultLog)
+	}
+	if c.LogPrefix != "" {
+		options = append(options, crawler.WithLoggerPrefix(c.LogPrefix))
+	}
+	if c.Delay > 0 {
+		options = append(options, crawler.WithPoliteness(crawler.NewPoliteness(time.Duration(c.Delay))))
+	}
+	if c.MaxRequests > 0 {
+		options = append(options, crawler.WithMaxRequests(c.MaxRequests))
+	}
+	for _, seed := range s.Seeds {
+		if strings.HasPrefix(seed, "file:") {
+			options = append(options, crawler.WithFileTransport(""))
+			break
+		}
+	}
+	if s.Report.JSON != "" || s.Report.HTML != "" {
+		p.report = crawler.NewReporter(time.Second, 10)
+		options = append(options, crawler.WithReport(p.report))
+	}
+	p.Crawler = crawler.NewCrawler(size, append(options, opts...)...)
+	// space in the Queue is freed once worker received a Request
+	for _, e := range []crawler.Event{crawler.RequestEvent, crawler.DropEvent, crawler.PanicEvent} {
+		p.Subscribe(e, func(crawler.Payload) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.flush()
+		})
+	}
+
+	var err error
+	if p.storage, err = NewStorage(s.Storage, stdout); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Run crawls seeds until the Crawler is idle or stopped, closes Storage and writes report.
+// Crawler is stopped on the first Storage error.
+func (p *Pipeline) Run() error {
+	var requests []crawler.Request
+	for _, seed := range p.spec.Seeds {
+		r, err := crawler.NewRequest(http.MethodGet, seed, nil)
+		if err != nil {
+			p.storage.Close()
+			return err
+		}
+		requests = append(requests, r)
+	}
+
+	idle := time.Duration(p.spec.Crawler.Idle)
+	if idle == 0 {
+		idle = time.Second * 2
+	}
+	p.Start()
+	for _, r := range requests {
+		p.push(r)
+	}
+	// storage is not safe to use by multiple goroutines
+	err := p.Consume(context.Background(), func(ctx context.Context, r crawler.Response) error {
+		return p.handle(r)
+	}, 1, crawler.WithConsumeIdle(idle), crawler.WithConsumePolicy(crawler.ConsumeStop))
+
+	if cerr := p.storage.Close(); err == nil {
+		err = cerr
+	}
+	if rerr := p.writeReport(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// writeReport writes report of the crawl to files described by ReportSpec.
+func (p *Pipeline) writeReport() error {
+	if p.report == nil {
+		return nil
+	}
+	report := p.report.Report()
+	for _, w := range []struct {
+		path  string
+		write func(io.Writer) error
+	}{{p.spec.Report.JSON, report.WriteJSON}, {p.spec.Report.HTML, report.WriteHTML}} {
+		if w.path == "" {
+			continue
+		}
+		f, err := os.Create(w.path)
+		if err != nil {
+			return err
+		}
+		err = w.write(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// push sends Request to the Crawler without blocking the caller.
+// Requests that do not fit into the Queue are sent once workers receive queued ones,
+// as workers could wait for the caller to handle their responses.
+func (p *Pipeline) push(r crawler.Request) {
+	if ua := p.spec.Crawler.UserAgent; ua != "" {
+		r.Request().Header.Set("User-Agent", ua)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, r)
+	p.flush()
+}
+
+// flush sends pending requests until the Queue is full, p.mu has to be locked.
+func (p *Pipeline) flush() {
+	for len(p.pending) > 0 {
+		r := p.pending[0]
+		err := p.TryPush(r)
+		if err == crawler.ErrorQueueFull {
+			return
+		}
+		if err != nil && err != crawler.ErrorQueueClosed {
+			p.Print("push of ", r.Request().URL, " failed: ", err)
+		}
+		p.pending[0] = nil
+		p.pending = p.pending[1:]
+	}
+}
+
+// handle stores Record of the Response and follows extracted links.
+// It is called by a single goroutine.
+func (p *Pipeline) handle(r crawler.Response) error {
+	record := &Record{
+		URL:   r.Request().URL.String(),
+		Depth: crawler.RequestDepth(r),
+		Took:  r.Time(),
+	}
+	if err := r.Error(); err != nil {
+		record.Error = err.Error()
+	}
+	var follow []string
+	if res := r.Response(); res != nil {
+		record.Status = res.StatusCode
+		record.Items, follow = p.items(res)
+	}
+	if p.report != nil {
+		for name, items := range record.Items {
+			p.report.AddItems(name, len(items))
+		}
+	}
+
+	if record.Depth < p.spec.Crawler.Depth {
+		for _, link := range follow {
+			if !p.InScope(link) {
+				continue
+			}
+			child, err := crawler.NewChildRequest(r, http.MethodGet, link, nil)
+			if err != nil {
+				continue
+			}
+			p.push(child)
+		}
+	}
+
+	return p.storage.Store(record)
+}
+
+// items extracts values from successful html responses.
+// Values of following extractors are returned as absolute urls,
+// file urls are followed only from local files.
+func (p *Pipeline) items(res *http.Response) (items map[string][]string, follow []string) {
+	if len(p.extract) == 0 || res.StatusCode < 200 || res.StatusCode >= 300 ||
+		!strings.Contains(res.Header.Get("Content-Type"), "html") {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil
+	}
+	items = map[string][]string{}
+	for _, e := range p.extract {
+		var collected = &values{}
+		if err := e.collector.Collect(bytes.NewReader(body), collected); err != nil {
+			continue
+		}
+		if !e.Follow {
+			items[e.Name] = *collected
+			continue
+		}
+		var seen = map[string]bool{}
+		for _, v := range *collected {
+			u, err := res.Request.URL.Parse(strings.TrimSpace(v))
+			if err != nil || !followed(res.Request.URL, u) {
+				continue
+			}
+			u.Fragment, u.RawFragment = "", ""
+			if link := u.String(); !seen[link] {
+				seen[link] = true
+				items[e.Name] = append(items[e.Name], link)
+				follow = append(follow, link)
+			}
+		}
+	}
+	return items, follow
+}
+
+// followed reports whether link of the document can be followed.
+func followed(document, link *url.URL) bool {
+	switch link.Scheme {
+	case "http", "https":
+		return true
+	case "file":
+		return document.Scheme == "file"
+	}
+	return false
+}
+
+// InScope reports whether link is allowed by Spec scope.
+func (p *Pipeline) InScope(link string) bool {
+	allowed := len(p.allow) == 0
+	for _, sel := range p.allow {
+		if len(sel.Score(link)) > 0 {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+	for _, sel := range p.deny {
+		if len(sel.Score(link)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// values is an io.Writer collecting each write as a separate value,
+// html collectors write each collected value at once.
+type values []string
+
+func (v *values) Write(p []byte) (int, error) {
+	*v = append(*v, string(p))
+	return len(p), nil
+}
@@ -0,0 +1,179 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package spec_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bukowa/micro/crawler"
+	. "github.com/bukowa/micro/spec"
+)
+
+func TestPipeline(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<title>Home</title><a href="/a">a</a><a href="/file.pdf">pdf</a><a href="/b">b</a>`)
+	})
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<title>A</title><a href="/c">c</a>`)
+	})
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, `<a href="/d">d</a>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := &Spec{
+		Seeds:   []string{server.URL + "/"},
+		Crawler: CrawlerSpec{Size: 2, Depth: 1, Idle: Duration(200e6)},
+		Scope: ScopeSpec{
+			Allow: []SelectorSpec{{Selector: "string_prefix", Match: []string{server.URL}}},
+			Deny:  []SelectorSpec{{Selector: "string_suffix", Match: []string{".pdf"}}},
+		},
+		Extract: []ExtractSpec{
+			{Name: "links", Selector: "a", Attributes: []string{"href"}, Follow: true},
+			{Name: "title", Selector: "title", Text: true},
+		},
+		Storage: StorageSpec{Type: StorageJSONL},
+	}
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s.Report = ReportSpec{JSON: filepath.Join(dir, "report.json"), HTML: filepath.Join(dir, "report.html")}
+	var out bytes.Buffer
+	p, err := New(s, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	var records = map[string]Record{}
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var r Record
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		records[strings.TrimPrefix(r.URL, server.URL)] = r
+	}
+	var urls []string
+	for u := range records {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	if fmt.Sprint(urls) != "[/ /a /b]" {
+		t.Errorf("invalid urls crawled: %v", urls)
+	}
+	home := records["/"]
+	if fmt.Sprint(home.Items["title"]) != "[Home]" {
+		t.Errorf("invalid title: %v", home.Items["title"])
+	}
+	if len(home.Items["links"]) != 3 || home.Items["links"][0] != server.URL+"/a" {
+		t.Errorf("invalid links: %v", home.Items["links"])
+	}
+	if records["/b"].Items != nil {
+		t.Errorf("items extracted from text: %v", records["/b"].Items)
+	}
+	if records["/a"].Depth != 1 {
+		t.Errorf("invalid depth: %v", records["/a"].Depth)
+	}
+
+	b, err := ioutil.ReadFile(s.Report.JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report crawler.Report
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Responses != 3 || report.Status[200] != 3 || report.Items["links"] != 4 || report.Items["title"] != 2 {
+		t.Errorf("invalid report: %+v", report)
+	}
+	if b, err := ioutil.ReadFile(s.Report.HTML); err != nil || !strings.Contains(string(b), "<td>links</td>") {
+		t.Errorf("invalid html report: %v", err)
+	}
+}
+
+func TestPipelineFullQueue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			for i := 0; i < 20; i++ {
+				fmt.Fprintf(w, `<a href="/%d">%d</a>`, i, i)
+			}
+		}
+	}))
+	defer server.Close()
+
+	// links do not fit into the Queue of size 1
+	s := &Spec{
+		Seeds:   []string{server.URL + "/"},
+		Crawler: CrawlerSpec{Size: 1, Depth: 1, Idle: Duration(200e6)},
+		Extract: []ExtractSpec{{Name: "links", Selector: "a", Attributes: []string{"href"}, Follow: true}},
+		Storage: StorageSpec{Type: StorageJSONL},
+	}
+	var out bytes.Buffer
+	p, err := New(s, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out.String(), "\n"); n != 21 {
+		t.Errorf("want 21 records, got %d", n)
+	}
+}
+
+func TestPipelineInScope(t *testing.T) {
+	p, err := New(&Spec{
+		Seeds: []string{"http://example.com"},
+		Scope: ScopeSpec{
+			Allow: []SelectorSpec{{Selector: "string_regexp", Match: []string{`^https?://example\.com/`}}},
+			Deny:  []SelectorSpec{{Selector: "string_contains", Match: []string{"/private/"}}},
+		},
+	}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for link, want := range map[string]bool{
+		"http://example.com/a":         true,
+		"https://example.com/b":        true,
+		"http://other.com/a":           false,
+		"http://example.com/private/a": false,
+	} {
+		if p.InScope(link) != want {
+			t.Errorf("%s: want %v", link, want)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package spec describes a complete crawl in a JSON or YAML document
+// and instantiates it into a running Pipeline.
+//
+// Example:
+//
+//	{
+//	  "name": "blog",
+//	  "seeds": ["https://example.com/blog/"],
+//	  "crawler": {"size": 4, "sleep": "10ms", "depth": 2, "delay": "500ms"},
+//	  "scope": {
+//	    "allow": [{"selector": "string_prefix", "match": ["https://example.com/blog/"]}],
+//	    "deny": [{"selector": "string_regexp", "match": ["\\.pdf$"]}]
+//	  },
+//	  "extract": [
+//	    {"name": "links", "selector": "a", "attributes": ["href"], "follow": true},
+//	    {"name": "title", "selector": "title", "text": true}
+//	  ],
+//	  "storage": {"type": "jsonl", "path": "blog.jsonl"},
+//	  "report": {"json": "blog-report.json", "html": "blog-report.html"}
+//	}
+//
+// The same spec written in YAML:
+//
+//	name: blog
+//	seeds: [https://example.com/blog/]
+//	crawler: {size: 4, sleep: 10ms, depth: 2, delay: 500ms}
+//	scope:
+//	  allow:
+//	    - selector: string_prefix
+//	      match: [https://example.com/blog/]
+//	  deny:
+//	    - {selector: string_regexp, match: ['\.pdf$']}
+//	extract:
+//	  - name: links
+//	    selector: a
+//	    attributes: [href]
+//	    follow: true
+//	  - {name: title, selector: title, text: true}
+//	storage: {type: jsonl, path: blog.jsonl}
+//	report: {json: blog-report.json, html: blog-report.html}
+//
+// Only a subset of YAML is supported: mappings and sequences, flow mappings
+// and sequences written in one line, scalars and comments.
+//
+// Seeds can be file:// urls, local files are crawled with crawler.FileTransport.
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bukowa/micro/selector"
+)
+
+// Storage types.
+const (
+	// StorageText writes a line per Record.
+	StorageText = "text"
+	// StorageJSONL writes a json object per Record.
+	StorageJSONL = "jsonl"
+	// StorageBolt stores records in bolt database under their url.
+	StorageBolt = "bolt"
+)
+
+// Spec describes a crawl.
+type Spec struct {
+	Name    string        `json:"name"`
+	Seeds   []string      `json:"seeds"`
+	Crawler CrawlerSpec   `json:"crawler"`
+	Scope   ScopeSpec     `json:"scope"`
+	Extract []ExtractSpec `json:"extract"`
+	Storage StorageSpec   `json:"storage"`
+	Report  ReportSpec    `json:"report"`
+}
+
+// CrawlerSpec describes options of the crawler.Crawler.
+type CrawlerSpec struct {
+	// Size is a number of concurrent requests, defaults to 4.
+	Size  int      `json:"size"`
+	Sleep Duration `json:"sleep"`
+	// Log enables default crawler log.
+	Log       bool   `json:"log"`
+	LogPrefix string `json:"log_prefix"`
+	// Depth is a maximum depth of followed links, 0 crawls only seeds.
+	Depth       int `json:"depth"`
+	MaxRequests int `json:"max_requests"`
+	// Delay is a delay between requests sent to the same host.
+	Delay Duration `json:"delay"`
+	// Idle is a time after which idle crawl is finished, defaults to 2s.
+	Idle      Duration `json:"idle"`
+	UserAgent string   `json:"user_agent"`
+}
+
+// ScopeSpec describes which followed links are crawled.
+// Link is crawled when it's scored by any of allow selectors,
+// or there are no allow selectors, and it's not scored by any of deny selectors.
+type ScopeSpec struct {
+	Allow []SelectorSpec `json:"allow"`
+	Deny  []SelectorSpec `json:"deny"`
+}
+
+// SelectorSpec describes selector.Selector by its name.
+type SelectorSpec struct {
+	Selector string   `json:"selector"`
+	Match    []string `json:"match"`
+}
+
+// ExtractSpec describes values extracted from html documents.
+type ExtractSpec struct {
+	Name string `json:"name"`
+	// Selector is a css selector of elements.
+	Selector string `json:"selector"`
+	// Attributes are extracted attributes of elements.
+	Attributes []string `json:"attributes"`
+	// Text extracts text of elements.
+	Text bool `json:"text"`
+	// Follow crawls extracted values as links.
+	Follow bool `json:"follow"`
+}
+
+// StorageSpec describes where records are written.
+type StorageSpec struct {
+	// Type is one of StorageText, StorageJSONL or StorageBolt, defaults to StorageText.
+	Type string `json:"type"`
+	// Path is a path of the output file, text and jsonl are written to stdout if it's empty.
+	Path string `json:"path"`
+}
+
+// ReportSpec describes where crawler.Report is written when the crawl is finished.
+type ReportSpec struct {
+	JSON string `json:"json"`
+	HTML string `json:"html"`
+}
+
+// Duration is a time.Duration encoded in json as a string, like "1.5s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Selectors are constructors of selectors available in specs by name.
+var Selectors = map[string]func(match ...string) (selector.Selector, error){
+	selector.XRegexpMatch: selector.RegexpMatch.New,
+	selector.XStringPrefix: func(match ...string) (selector.Selector, error) {
+		return selector.StringPrefix.New(match...), nil
+	},
+	selector.XStringSuffix: func(match ...string) (selector.Selector, error) {
+		return selector.StringSuffix.New(match...), nil
+	},
+	selector.XStringEqual: func(match ...string) (selector.Selector, error) {
+		return selector.StringEqual.New(match...), nil
+	},
+	selector.XStringEqualFold: func(match ...string) (selector.Selector, error) {
+		return selector.StringEqualFold.New(match...), nil
+	},
+	selector.XStringContains: func(match ...string) (selector.Selector, error) {
+		return selector.StringContains.New(match...), nil
+	},
+}
+
+// ErrorSpec is returned when Spec is invalid, it contains all found problems.
+type ErrorSpec []string
+
+func (e ErrorSpec) Error() string {
+	return "invalid spec: " + strings.Join(e, "; ")
+}
+
+// Parse decodes and validates Spec written in JSON or YAML,
+// document starting with { is JSON.
+// Unknown fields are rejected, so typos are not silently ignored.
+func Parse(r io.Reader) (*Spec, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if t := bytes.TrimSpace(b); len(t) == 0 || t[0] != '{' {
+		v, err := parseYAML(b)
+		if err != nil {
+			return nil, err
+		}
+		if b, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	var s = &Spec{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(s); err != nil {
+		return nil, err
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load parses Spec from file.
+func Load(path string) (*Spec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Validate checks Spec, returned error is ErrorSpec.
+func (s *Spec) Validate() error {
+	var errs ErrorSpec
+	var fail = func(format string, v ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, v...))
+	}
+
+	if len(s.Seeds) == 0 {
+		fail("no seeds")
+	}
+	for _, seed := range s.Seeds {
+		u, err := url.Parse(seed)
+		if err != nil || !((u.Scheme == "http" || u.Scheme == "https") && u.Host != "" || u.Scheme == "file" && u.Path != "") {
+			fail("seed %q is not an absolute http or file url", seed)
+		}
+	}
+
+	c := s.Crawler
+	if c.Size < 0 {
+		fail("crawler size %d is negative", c.Size)
+	}
+	if c.Depth < 0 {
+		fail("crawler depth %d is negative", c.Depth)
+	}
+	if c.MaxRequests < 0 {
+		fail("crawler max_requests %d is negative", c.MaxRequests)
+	}
+	if c.Sleep < 0 || c.Delay < 0 || c.Idle < 0 {
+		fail("crawler durations cannot be negative")
+	}
+
+	for _, sel := range append(append([]SelectorSpec{}, s.Scope.Allow...), s.Scope.Deny...) {
+		if _, err := sel.New(); err != nil {
+			fail("%s", err)
+		}
+	}
+
+	var names = map[string]bool{}
+	for i, e := range s.Extract {
+		switch {
+		case e.Name == "":
+			fail("extract %d has no name", i)
+		case names[e.Name]:
+			fail("extract %q is duplicated", e.Name)
+		}
+		names[e.Name] = true
+		if e.Selector == "" {
+			fail("extract %q has no selector", e.Name)
+		}
+		if len(e.Attributes) == 0 && !e.Text {
+			fail("extract %q has neither attributes nor text", e.Name)
+		}
+		if e.Follow && len(e.Attributes) == 0 {
+			fail("extract %q follows links but has no attributes", e.Name)
+		}
+	}
+
+	switch s.Storage.Type {
+	case "", StorageText, StorageJSONL:
+	case StorageBolt:
+		if s.Storage.Path == "" {
+			fail("bolt storage requires path")
+		}
+	default:
+		fail("unknown storage type %q", s.Storage.Type)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// New creates selector.Selector described by SelectorSpec.
+func (s SelectorSpec) New() (selector.Selector, error) {
+	f, ok := Selectors[s.Selector]
+	if !ok {
+		return nil, fmt.Errorf("unknown selector %q", s.Selector)
+	}
+	if len(s.Match) == 0 {
+		return nil, fmt.Errorf("selector %q has nothing to match", s.Selector)
+	}
+	return f(s.Match...)
+}
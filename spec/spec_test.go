@@ -0,0 +1,150 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package spec_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bukowa/micro/spec"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse(strings.NewReader(`{
+		"name": "test",
+		"seeds": ["https://example.com/"],
+		"crawler": {"size": 2, "sleep": "10ms", "depth": 1, "idle": "1s"},
+		"scope": {"allow": [{"selector": "string_prefix", "match": ["https://example.com/"]}]},
+		"extract": [{"name": "links", "selector": "a", "attributes": ["href"], "follow": true}],
+		"storage": {"type": "jsonl"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Crawler.Size != 2 || time.Duration(s.Crawler.Sleep) != time.Millisecond*10 || len(s.Extract) != 1 {
+		t.Errorf("invalid spec: %+v", s)
+	}
+
+	if _, err := Parse(strings.NewReader(`{"seeds": ["https://example.com/"], "sede": 1}`)); err == nil {
+		t.Error("unknown field accepted")
+	}
+	if _, err := Parse(strings.NewReader(`{"seeds": ["https://example.com/"], "crawler": {"sleep": "x"}}`)); err == nil {
+		t.Error("invalid duration accepted")
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	j, err := Parse(strings.NewReader(`{
+		"name": "blog",
+		"seeds": ["https://example.com/blog/"],
+		"crawler": {"size": 4, "sleep": "10ms", "depth": 2, "delay": "500ms"},
+		"scope": {
+			"allow": [{"selector": "string_prefix", "match": ["https://example.com/blog/"]}],
+			"deny": [{"selector": "string_regexp", "match": ["\\.pdf$", "a#b"]}]
+		},
+		"extract": [
+			{"name": "links", "selector": "a", "attributes": ["href"], "follow": true},
+			{"name": "title", "selector": "title", "text": true}
+		],
+		"storage": {"type": "jsonl", "path": "blog.jsonl"},
+		"report": {"json": "blog-report.json", "html": "blog-report.html"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, err := Parse(strings.NewReader(`
+# crawl of the blog
+name: blog
+seeds: [https://example.com/blog/]
+crawler: {size: 4, sleep: 10ms, depth: 2, delay: 500ms}
+scope:
+  allow:
+    - selector: string_prefix
+      match:
+      - https://example.com/blog/
+  deny:
+    - {selector: string_regexp, match: ['\.pdf$', "a#b"]} # quoted comment sign
+extract:
+  - name: links
+    selector: a
+    attributes: [href]
+    follow: true
+  - {name: title, selector: title, text: true}
+storage: {type: jsonl, path: blog.jsonl}
+report:
+  json: blog-report.json
+  html: "blog-report.html"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(j, y) {
+		t.Errorf("yaml spec differs:\n%+v\n%+v", j, y)
+	}
+
+	for _, doc := range []string{
+		"seeds: [https://example.com/]\nsede: 1",
+		"seeds: [https://example.com/]\ncrawler:\n  size: 1\n    sleep: 1s",
+		"seeds: [https://example.com/]\ncrawler:\n\tsize: 1",
+		"seeds: [https://example.com/\n",
+		"seeds: [https://example.com/]\nname: |\n  blog",
+	} {
+		if _, err := Parse(strings.NewReader(doc)); err == nil {
+			t.Errorf("invalid spec accepted: %q", doc)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := &Spec{
+		Seeds: []string{"example.com", "ftp://example.com"},
+		Scope: ScopeSpec{
+			Allow: []SelectorSpec{{Selector: "unknown", Match: []string{"x"}}},
+			Deny:  []SelectorSpec{{Selector: "string_regexp", Match: []string{"("}}},
+		},
+		Extract: []ExtractSpec{
+			{Name: "a", Selector: "a", Attributes: []string{"href"}},
+			{Name: "a", Selector: "a", Text: true, Follow: true},
+			{Selector: "p"},
+		},
+		Storage: StorageSpec{Type: StorageBolt},
+	}
+	err, ok := s.Validate().(ErrorSpec)
+	if !ok {
+		t.Fatalf("want ErrorSpec, got %v", err)
+	}
+	want := []string{
+		`seed "example.com" is not an absolute http or file url`,
+		`seed "ftp://example.com" is not an absolute http or file url`,
+		`unknown selector "unknown"`,
+		"missing closing )",
+		`extract "a" is duplicated`,
+		`extract "a" follows links but has no attributes`,
+		`extract 2 has no name`,
+		`extract "" has neither attributes nor text`,
+		"bolt storage requires path",
+	}
+	if len(err) != len(want) {
+		t.Fatalf("want %d errors, got %d: %v", len(want), len(err), err)
+	}
+	for i := range want {
+		if !strings.Contains(err[i], want[i]) {
+			t.Errorf("want %q, got %q", want[i], err[i])
+		}
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bukowa/micro/storage/bolt"
+)
+
+// Record is a result of a single crawled url.
+type Record struct {
+	URL    string        `json:"url"`
+	Status int           `json:"status,omitempty"`
+	Depth  int           `json:"depth"`
+	Error  string        `json:"error,omitempty"`
+	Took   time.Duration `json:"took"`
+	// Items are values extracted by each ExtractSpec.
+	Items map[string][]string `json:"items,omitempty"`
+}
+
+// Key implements bolt.Model, records are stored under their url.
+func (r *Record) Key() []byte {
+	return []byte(r.URL)
+}
+
+func (r *Record) SetKey(b []byte) {
+	r.URL = string(b)
+}
+
+// Storage writes records.
+type Storage interface {
+	Store(r *Record) error
+	Close() error
+}
+
+// NewStorage creates Storage described by StorageSpec.
+// Text and jsonl storages without path write to stdout.
+func NewStorage(s StorageSpec, stdout io.Writer) (Storage, error) {
+	if s.Type == StorageBolt {
+		storage, err := bolt.NewStorage(nil, s.Path, &Record{})
+		if err != nil {
+			return nil, err
+		}
+		return &boltStorage{storage: storage}, nil
+	}
+
+	var w = stdout
+	var closer io.Closer
+	if s.Path != "" {
+		f, err := os.Create(s.Path)
+		if err != nil {
+			return nil, err
+		}
+		w, closer = f, f
+	}
+	switch s.Type {
+	case "", StorageText:
+		return &textStorage{w: w, closer: closer}, nil
+	case StorageJSONL:
+		return &jsonlStorage{enc: json.NewEncoder(w), closer: closer}, nil
+	}
+	if closer != nil {
+		closer.Close()
+	}
+	return nil, fmt.Errorf("unknown storage type %q", s.Type)
+}
+
+// textStorage writes a line per Record.
+type textStorage struct {
+	w      io.Writer
+	closer io.Closer
+}
+
+func (s *textStorage) Store(r *Record) error {
+	if r.Error != "" {
+		_, err := fmt.Fprintf(s.w, "ERR %s %s\n", r.URL, r.Error)
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d %s depth:%d took:%s", r.Status, r.URL, r.Depth, r.Took)
+	var names []string
+	for name := range r.Items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, " %s:%d", name, len(r.Items[name]))
+	}
+	b.WriteByte('\n')
+	_, err := io.WriteString(s.w, b.String())
+	return err
+}
+
+func (s *textStorage) Close() error {
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+// jsonlStorage writes a json object per line.
+type jsonlStorage struct {
+	enc    *json.Encoder
+	closer io.Closer
+}
+
+func (s *jsonlStorage) Store(r *Record) error {
+	return s.enc.Encode(r)
+}
+
+func (s *jsonlStorage) Close() error {
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+// boltStorage stores records in bolt database.
+type boltStorage struct {
+	storage bolt.Storage
+}
+
+func (s *boltStorage) Store(r *Record) error {
+	return s.storage.Create(r)
+}
+
+func (s *boltStorage) Close() error {
+	return s.storage.Bolt().Close()
+}
@@ -0,0 +1,407 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package spec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML decodes subset of YAML enough to write specs into values
+// that can be encoded as json: block mappings and sequences indented with spaces,
+// flow mappings and sequences written in one line, plain, single and double
+// quoted scalars and comments. Anchors, tags, block scalars and multiple
+// documents are not supported.
+func parseYAML(b []byte) (interface{}, error) {
+	p := &yamlParser{}
+	for n, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		text := strings.TrimLeft(line, " ")
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs cannot be used for indentation", n+1)
+		}
+		text = strings.TrimRight(stripComment(text), " \t")
+		if text == "" || text == "---" || text == "..." {
+			continue
+		}
+		p.lines = append(p.lines, yamlLine{n: n + 1, indent: len(line) - len(text), text: text})
+	}
+	if len(p.lines) == 0 {
+		return nil, fmt.Errorf("yaml: empty document")
+	}
+	v, err := p.block(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.lines) {
+		return nil, p.lines[p.i].errorf("unexpected indentation")
+	}
+	return v, nil
+}
+
+// yamlLine is a line of the document without indentation and comment.
+type yamlLine struct {
+	n      int
+	indent int
+	text   string
+}
+
+func (l yamlLine) errorf(format string, v ...interface{}) error {
+	return fmt.Errorf("yaml: line %d: %s", l.n, fmt.Sprintf(format, v...))
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+// block decodes mapping, sequence or scalar starting at current line.
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	l := p.lines[p.i]
+	if isItem(l.text) {
+		return p.sequence(indent)
+	}
+	if _, _, ok := splitKey(l.text); ok {
+		return p.mapping(indent)
+	}
+	p.i++
+	return scalar(l, l.text)
+}
+
+// sequence decodes items of the sequence indented by indent.
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	var seq = []interface{}{}
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		if l.indent < indent || l.indent == indent && !isItem(l.text) {
+			break
+		}
+		if l.indent > indent {
+			return nil, l.errorf("unexpected indentation")
+		}
+		rest := strings.TrimLeft(l.text[1:], " ")
+		var v interface{}
+		var err error
+		if rest == "" {
+			p.i++
+			if p.i < len(p.lines) && p.lines[p.i].indent > indent {
+				v, err = p.block(p.lines[p.i].indent)
+			}
+		} else {
+			// content of the item is decoded as if it started its own line
+			column := l.indent + len(l.text) - len(rest)
+			p.lines[p.i] = yamlLine{n: l.n, indent: column, text: rest}
+			v, err = p.block(column)
+		}
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+	}
+	return seq, nil
+}
+
+// mapping decodes keys of the mapping indented by indent.
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	var m = map[string]interface{}{}
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, l.errorf("unexpected indentation")
+		}
+		key, rest, ok := splitKey(l.text)
+		if !ok {
+			return nil, l.errorf("want key, got %q", l.text)
+		}
+		if _, ok := m[key]; ok {
+			return nil, l.errorf("duplicated key %q", key)
+		}
+		p.i++
+		var v interface{}
+		var err error
+		switch {
+		case rest != "":
+			v, err = scalar(l, rest)
+		case p.i >= len(p.lines):
+		case p.lines[p.i].indent > indent:
+			v, err = p.block(p.lines[p.i].indent)
+		case p.lines[p.i].indent == indent && isItem(p.lines[p.i].text):
+			// sequence can be indented as its key
+			v, err = p.sequence(indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// isItem reports whether text is an item of block sequence.
+func isItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitKey splits "key: value" into unquoted key and value.
+func splitKey(text string) (key, rest string, ok bool) {
+	if text == "" || text[0] == '[' || text[0] == '{' || isItem(text) {
+		return "", "", false
+	}
+	var i int
+	if text[0] == '"' || text[0] == '\'' {
+		end := closingQuote(text)
+		if end < 0 {
+			return "", "", false
+		}
+		i = end + 1
+		if i >= len(text) || text[i] != ':' {
+			return "", "", false
+		}
+	} else {
+		i = strings.Index(text, ": ")
+		if i < 0 {
+			if !strings.HasSuffix(text, ":") {
+				return "", "", false
+			}
+			i = len(text) - 1
+		}
+	}
+	key = strings.TrimSpace(text[:i])
+	if key != "" && (key[0] == '"' || key[0] == '\'') {
+		var err error
+		if key, err = unquote(key); err != nil {
+			return "", "", false
+		}
+	}
+	return key, strings.TrimSpace(text[i+1:]), true
+}
+
+// scalar decodes value written in one line.
+func scalar(l yamlLine, text string) (interface{}, error) {
+	switch text[0] {
+	case '|', '>', '&', '*', '!':
+		return nil, l.errorf("unsupported value %q", text)
+	}
+	f := &yamlFlow{s: text}
+	v, err := f.value()
+	if err != nil {
+		return nil, l.errorf("%s", err)
+	}
+	if f.space(); f.i < len(f.s) {
+		return nil, l.errorf("unexpected %q", f.s[f.i:])
+	}
+	return v, nil
+}
+
+// yamlFlow decodes flow values.
+type yamlFlow struct {
+	s string
+	i int
+}
+
+func (f *yamlFlow) space() {
+	for f.i < len(f.s) && f.s[f.i] == ' ' {
+		f.i++
+	}
+}
+
+func (f *yamlFlow) value() (interface{}, error) {
+	f.space()
+	if f.i >= len(f.s) {
+		return nil, nil
+	}
+	switch f.s[f.i] {
+	case '[':
+		f.i++
+		var seq = []interface{}{}
+		for {
+			f.space()
+			if f.i < len(f.s) && f.s[f.i] == ']' {
+				f.i++
+				return seq, nil
+			}
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			if err := f.next(']'); err != nil {
+				return nil, err
+			}
+			if f.s[f.i-1] == ']' {
+				return seq, nil
+			}
+		}
+	case '{':
+		f.i++
+		var m = map[string]interface{}{}
+		for {
+			f.space()
+			if f.i < len(f.s) && f.s[f.i] == '}' {
+				f.i++
+				return m, nil
+			}
+			key, err := f.key()
+			if err != nil {
+				return nil, err
+			}
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			if err := f.next('}'); err != nil {
+				return nil, err
+			}
+			if f.s[f.i-1] == '}' {
+				return m, nil
+			}
+		}
+	case '"', '\'':
+		end := closingQuote(f.s[f.i:])
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		s, err := unquote(f.s[f.i : f.i+end+1])
+		f.i += end + 1
+		return s, err
+	}
+	start := f.i
+	for f.i < len(f.s) && strings.IndexByte(",]}", f.s[f.i]) < 0 {
+		f.i++
+	}
+	return plain(strings.TrimSpace(f.s[start:f.i])), nil
+}
+
+// key decodes key of the flow mapping and its colon.
+func (f *yamlFlow) key() (string, error) {
+	f.space()
+	var key string
+	if f.i < len(f.s) && (f.s[f.i] == '"' || f.s[f.i] == '\'') {
+		end := closingQuote(f.s[f.i:])
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		var err error
+		if key, err = unquote(f.s[f.i : f.i+end+1]); err != nil {
+			return "", err
+		}
+		f.i += end + 1
+		f.space()
+	} else {
+		start := f.i
+		for f.i < len(f.s) && f.s[f.i] != ':' && strings.IndexByte(",]}", f.s[f.i]) < 0 {
+			f.i++
+		}
+		key = strings.TrimSpace(f.s[start:f.i])
+	}
+	if f.i >= len(f.s) || f.s[f.i] != ':' {
+		return "", fmt.Errorf("missing colon after key %q", key)
+	}
+	f.i++
+	return key, nil
+}
+
+// next consumes comma or closing bracket.
+func (f *yamlFlow) next(closing byte) error {
+	f.space()
+	if f.i < len(f.s) && (f.s[f.i] == ',' || f.s[f.i] == closing) {
+		f.i++
+		return nil
+	}
+	return fmt.Errorf("missing %q", closing)
+}
+
+// closingQuote returns index of the quote closing string starting at s[0] or -1.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[0] == '"' && s[i] == '\\':
+			i++
+		case s[i] == s[0] && s[0] == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			// escaped single quote
+			i++
+		case s[i] == s[0]:
+			return i
+		}
+	}
+	return -1
+}
+
+func unquote(s string) (string, error) {
+	if s[0] == '\'' {
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	}
+	return strconv.Unquote(s)
+}
+
+// stripComment removes comment that is not part of quoted string.
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.IndexByte(" [{,:-", text[i-1]) >= 0 {
+				quote = c
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' '):
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// plain decodes plain scalar into null, bool, number or string.
+func plain(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if isNumber(s) {
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n
+		}
+	}
+	return s
+}
+
+// isNumber reports whether s is a decimal number, strconv accepts also
+// infinities, hexadecimal numbers and underscores.
+func isNumber(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	if s == "" || s[0] < '0' || s[0] > '9' && s[0] != '.' {
+		return false
+	}
+	return strings.Trim(s, "0123456789.eE+-") == ""
+}
@@ -0,0 +1,58 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package bolt
+
+import (
+	"github.com/bukowa/micro/crawler"
+)
+
+// Checkpoint is a Model storing crawler.Snapshot under Name.
+type Checkpoint struct {
+	crawler.Snapshot
+	Name []byte `json:"-"`
+}
+
+func (c *Checkpoint) Key() []byte {
+	return c.Name
+}
+
+func (c *Checkpoint) SetKey(b []byte) {
+	c.Name = b
+}
+
+// NewCheckpointStore creates crawler.CheckpointStore saving snapshots
+// into Storage under given name.
+func NewCheckpointStore(storage Storage, name string) (crawler.CheckpointStore, error) {
+	if err := storage.Init(&Checkpoint{}); err != nil {
+		return nil, err
+	}
+	return &checkpointStore{storage: storage, name: name}, nil
+}
+
+type checkpointStore struct {
+	storage Storage
+	name    string
+}
+
+func (s *checkpointStore) Save(snapshot crawler.Snapshot) error {
+	return s.storage.Create(&Checkpoint{Snapshot: snapshot, Name: []byte(s.name)})
+}
+
+func (s *checkpointStore) Load() (crawler.Snapshot, error) {
+	c := &Checkpoint{Name: []byte(s.name)}
+	err := s.storage.Get(c)
+	return c.Snapshot, err
+}
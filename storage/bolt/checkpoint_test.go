@@ -0,0 +1,52 @@
+/*
+Copyright © 2020 Mateusz Kurowski
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package bolt_test
+
+import (
+	"testing"
+
+	"github.com/bukowa/micro/crawler"
+	. "github.com/bukowa/micro/storage/bolt"
+)
+
+func TestCheckpointStore(t *testing.T) {
+	db, def := TestDatabase()
+	defer def()
+
+	store, err := NewCheckpointStore(db, "crawl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(); err != ErrorNotFound {
+		t.Errorf("want ErrorNotFound, got: %v", err)
+	}
+
+	snapshot := crawler.Snapshot{
+		Pending:  []crawler.SnapshotRequest{{Method: "POST", URL: "http://localhost", Body: []byte("body")}},
+		Seen:     []string{"GET http://localhost"},
+		Requests: 5,
+	}
+	if err := store.Save(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Requests != 5 || len(loaded.Seen) != 1 || string(loaded.Pending[0].Body) != "body" {
+		t.Errorf("invalid snapshot: %+v", loaded)
+	}
+}